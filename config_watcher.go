@@ -0,0 +1,194 @@
+package goservice
+
+import (
+	"flag"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/util/filewatch"
+)
+
+// configWatcher watches env files and re-applies values of dynamic flags
+// when the files changed, subscribers are notified with old and new values
+type configWatcher struct {
+	s         *service
+	enabled   bool
+	interval  time.Duration
+	forcePoll bool
+	mu        sync.Mutex
+	stopped   bool
+	watcher   *filewatch.Watcher
+}
+
+func newConfigWatcher(s *service) *configWatcher {
+	return &configWatcher{s: s}
+}
+
+func (cw *configWatcher) Name() string { return "config-watcher" }
+
+func (cw *configWatcher) InitFlags() {
+	flag.BoolVar(&cw.enabled, "config-watch", false, "Watch env files and reload dynamic flags when they changed")
+	flag.DurationVar(&cw.interval, "config-watch-interval", 5*time.Second, "Polling interval, used when inotify is not available")
+	flag.BoolVar(&cw.forcePoll, "config-watch-poll", false, "Always poll env files instead of using inotify")
+}
+
+func (cw *configWatcher) Configure() error { return nil }
+
+func (cw *configWatcher) Run() error {
+	if !cw.enabled {
+		return nil
+	}
+
+	if len(cw.s.dynamicFlags) == 0 {
+		cw.s.logger.Warnln("config watching is enabled but there is no dynamic flag")
+		return nil
+	}
+
+	logger := cw.s.Logger("config-watcher")
+	w := filewatch.New(cw.s.envFiles,
+		filewatch.WithPollInterval(cw.interval),
+		filewatch.WithForcePoll(cw.forcePoll),
+		filewatch.WithLogger(logger),
+	)
+
+	cw.mu.Lock()
+	if cw.stopped {
+		cw.mu.Unlock()
+		return nil
+	}
+	cw.watcher = w
+	cw.mu.Unlock()
+
+	logger.Infof("watching %s", strings.Join(cw.s.envFiles, ", "))
+	return w.Watch(func(files []string) {
+		logger.Infof("%s changed, reloading config...", strings.Join(files, ", "))
+		// serialized with Reload, so values are staged and handlers called in order
+		cw.s.reloadMu.Lock()
+		defer cw.s.reloadMu.Unlock()
+		if err := cw.s.reloadConfig(); err != nil {
+			logger.Errorln("reloading config:", err)
+		}
+	})
+}
+
+func (cw *configWatcher) Stop() <-chan bool {
+	c := make(chan bool)
+	go func() {
+		cw.mu.Lock()
+		cw.stopped = true
+		if cw.watcher != nil {
+			cw.watcher.Stop()
+		}
+		cw.mu.Unlock()
+		c <- true
+	}()
+	return c
+}
+
+type configChange struct {
+	name     string
+	oldValue string
+	newValue string
+}
+
+// reloadConfig reads env files again and stages new values of dynamic flags.
+// Variables bound to flags are read by other goroutines, so they are never
+// written here: subscribers apply new values, and HTTP servers get them on Reload.
+// Variables that come from the process environment always win over files
+func (s *service) reloadConfig() error {
+	values, err := s.readEnvFiles()
+	if err != nil {
+		return err
+	}
+
+	var changes []configChange
+	s.configMu.Lock()
+	s.cmdLine.VisitAll(func(f *flag.Flag) {
+		if !s.dynamicFlags[f.Name] {
+			return
+		}
+
+		envName := s.cmdLine.EnvName(f.Name)
+		if s.processEnv[envName] {
+			return
+		}
+
+		newValue, ok := values[envName]
+		if !ok || newValue == "" {
+			newValue = s.flagDefault(f)
+		}
+
+		staged, err := stageFlagValue(f, newValue)
+		if err != nil {
+			s.logger.Errorf("cannot set flag %q with value %q: %s",
+				f.Name, MaskFlagValue(f.Name, newValue), err.Error())
+			return
+		}
+
+		if safe, forced := s.guardedValue(f.Name, staged); forced {
+			s.logger.Warnf("%s=%s is not allowed in %s, using %s", f.Name, MaskFlagValue(f.Name, newValue), s.env, safe)
+			staged = safe
+		}
+
+		oldValue := s.configValues[f.Name]
+		if staged == oldValue {
+			return
+		}
+
+		s.configValues[f.Name] = staged
+		changes = append(changes, configChange{f.Name, oldValue, staged})
+	})
+	s.configMu.Unlock()
+
+	for _, c := range changes {
+		s.logger.Infof("flag %s changed: %q => %q", c.name,
+			MaskFlagValue(c.name, c.oldValue), MaskFlagValue(c.name, c.newValue))
+
+		s.configMu.RLock()
+		handlers := s.configHandlers[c.name]
+		s.configMu.RUnlock()
+
+		for _, hdl := range handlers {
+			hdl(c.name, c.oldValue, c.newValue)
+		}
+	}
+
+	return nil
+}
+
+// snapshotConfig records values of flags after they are parsed,
+// they are the current values until dynamic flags are reloaded
+func (s *service) snapshotConfig() {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.configValues = map[string]string{}
+	s.cmdLine.VisitAll(func(f *flag.Flag) {
+		s.configValues[f.Name] = f.Value.String()
+	})
+}
+
+// dynamicConfig returns current values of dynamic flags
+func (s *service) dynamicConfig() map[string]string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	values := map[string]string{}
+	for name := range s.dynamicFlags {
+		if v, ok := s.configValues[name]; ok {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+func (s *service) ConfigValue(flagName string) string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.configValues[flagName]
+}
+
+func (s *service) OnConfigChange(flagName string, hdl ConfigChangeHandler) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.configHandlers[flagName] = append(s.configHandlers[flagName], hdl)
+}
@@ -0,0 +1,194 @@
+package goservice
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+)
+
+// newTestService creates a service with its own flag set, flags are read from envFile
+func newTestService(t *testing.T, fs *flag.FlagSet, envFile string) *service {
+	t.Helper()
+	logger.InitServLogger(false)
+
+	s := New().(*service)
+	s.logger = logger.GetCurrent().GetLogger("test")
+	s.env = DevEnv
+	s.cmdLine = newFlagSet("test", fs, "")
+	s.envFiles = []string{envFile}
+	s.processEnv = map[string]bool{}
+	return s
+}
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, ".env")
+
+	tests := []struct {
+		name       string
+		env        string
+		processEnv bool
+		content    string
+		wantValue  string
+		wantChange bool
+	}{
+		{name: "changed", content: "RATE_LIMIT=20\n", wantValue: "20", wantChange: true},
+		{name: "unchanged", content: "RATE_LIMIT=10\n", wantValue: "10"},
+		{name: "removed uses default", content: "OTHER=1\n", wantValue: "5", wantChange: true},
+		{name: "invalid is ignored", content: "RATE_LIMIT=abc\n", wantValue: "10"},
+		{name: "process env wins", processEnv: true, content: "RATE_LIMIT=20\n", wantValue: "10"},
+		{name: "not dynamic", content: "RATE_LIMIT=10\nSTATIC=changed\n", wantValue: "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			rate := fs.Int("rate-limit", 5, "")
+			static := fs.String("static", "initial", "")
+			_ = fs.Set("rate-limit", "10")
+
+			writeFile(t, envFile, tt.content)
+			s := newTestService(t, fs, envFile)
+			s.dynamicFlags["rate-limit"] = true
+			s.processEnv["RATE_LIMIT"] = tt.processEnv
+			s.snapshotConfig()
+
+			var changes []configChange
+			s.OnConfigChange("rate-limit", func(name, oldValue, newValue string) {
+				changes = append(changes, configChange{name, oldValue, newValue})
+			})
+
+			if err := s.reloadConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := s.ConfigValue("rate-limit"); got != tt.wantValue {
+				t.Errorf("ConfigValue() = %q, want %q", got, tt.wantValue)
+			}
+			if tt.wantChange != (len(changes) == 1) {
+				t.Errorf("changes = %v, want change %v", changes, tt.wantChange)
+			}
+			if tt.wantChange && (changes[0].oldValue != "10" || changes[0].newValue != tt.wantValue) {
+				t.Errorf("change = %+v, want 10 => %s", changes[0], tt.wantValue)
+			}
+			// only subscribers and ConfigValue see new values, bound variables
+			// keep their startup values, see WithDynamicFlags
+			if *rate != 10 || *static != "initial" {
+				t.Errorf("bound variables changed: rate-limit=%d static=%s", *rate, *static)
+			}
+			if got := s.ConfigValue("static"); got != "initial" {
+				t.Errorf("ConfigValue(static) = %q, want initial", got)
+			}
+		})
+	}
+}
+
+func TestReloadConfigGuardsPrd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, ".env")
+	writeFile(t, envFile, "FIBER_PPROF=true\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("fiber-pprof", false, "")
+	s := newTestService(t, fs, envFile)
+	s.env = PrdEnv
+	s.dynamicFlags["fiber-pprof"] = true
+	s.snapshotConfig()
+
+	if err := s.reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.ConfigValue("fiber-pprof"); got != "false" {
+		t.Errorf("fiber-pprof = %q in prd, want false", got)
+	}
+}
+
+func TestConfigWatcherWaitsForReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, ".env")
+	writeFile(t, envFile, "RATE_LIMIT=10\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("rate-limit", 10, "")
+	s := newTestService(t, fs, envFile)
+	s.dynamicFlags["rate-limit"] = true
+	s.snapshotConfig()
+
+	changed := make(chan string, 1)
+	s.OnConfigChange("rate-limit", func(_, _, newValue string) { changed <- newValue })
+
+	cw := newConfigWatcher(s)
+	cw.enabled, cw.forcePoll, cw.interval = true, true, 10*time.Millisecond
+	go func() { _ = cw.Run() }()
+	defer func() { <-cw.Stop() }()
+	// the first poll remembers the content
+	time.Sleep(50 * time.Millisecond)
+
+	// a reload in progress, ex: by SIGHUP
+	s.reloadMu.Lock()
+	writeFile(t, envFile, "RATE_LIMIT=20\n")
+	select {
+	case v := <-changed:
+		t.Fatalf("reloaded %s during another reload", v)
+	case <-time.After(100 * time.Millisecond):
+	}
+	s.reloadMu.Unlock()
+
+	select {
+	case v := <-changed:
+		if v != "20" {
+			t.Errorf("new value = %s, want 20", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("config is not reloaded after the other reload")
+	}
+}
+
+func TestStageFlagValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	b := fs.Bool("b", false, "")
+	d := fs.Duration("d", 0, "")
+	fs.Int("i", 0, "")
+
+	tests := []struct {
+		flag, value, want string
+		wantErr           bool
+	}{
+		{"b", "1", "true", false},
+		{"d", "90s", "1m30s", false},
+		{"i", "42", "42", false},
+		{"i", "x", "", true},
+	}
+	for _, tt := range tests {
+		got, err := stageFlagValue(fs.Lookup(tt.flag), tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("stageFlagValue(%s, %q) = %q, %v, want %q", tt.flag, tt.value, got, err, tt.want)
+		}
+	}
+	if *b || *d != 0 {
+		t.Errorf("bound variables changed: b=%v d=%v", *b, *d)
+	}
+}
@@ -0,0 +1,124 @@
+package goservice
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var envProfiles = []string{DevEnv, StgEnv, PrdEnv}
+
+// Settings that must never be on in prd, mapped to their safe value.
+// They are forced to the safe value unless -app-allow-dev-features is set
+var defaultDevOnlyFlags = map[string]string{
+	"fiber-pprof":          "false",
+	"fiber-route-table":    "false",
+	"fiber-verbose-errors": "false",
+}
+
+// Values of flags which are too verbose for prd, mapped to the value used instead
+var devOnlyFlagValues = map[string]map[string]string{
+	"log-level":  {"trace": "debug"},
+	"fiber-mode": {"debug": "release"},
+}
+
+func isKnownEnv(env string) bool {
+	for _, e := range envProfiles {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnvProfile validates app-env, applies per-env defaults of flags
+// which are not set explicitly, and enforces guardrails of prd
+func (s *service) applyEnvProfile() {
+	if !isKnownEnv(s.env) {
+		s.logger.Fatalf("unknown app-env %q, must be one of: %s", s.env, strings.Join(envProfiles, " | "))
+	}
+
+	explicit := map[string]bool{}
+	s.cmdLine.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for name, value := range s.envDefaults[s.env] {
+		if explicit[name] {
+			continue
+		}
+
+		f := s.cmdLine.Lookup(name)
+		if f == nil {
+			s.logger.Fatalf("default value for %s: flag %q is not defined", s.env, name)
+		}
+		if err := f.Value.Set(value); err != nil {
+			s.logger.Fatalf("default value for %s: flag %q: %s", s.env, name, err.Error())
+		}
+	}
+
+	s.cmdLine.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if safe, forced := s.guardedValue(f.Name, value); forced {
+			_ = f.Value.Set(safe)
+			// defaults of the SDK are dev friendly, only warn what is set on purpose
+			if !explicit[f.Name] {
+				return
+			}
+			s.logger.Warnf("%s=%s is not allowed in %s, using %s (set -app-allow-dev-features to override)",
+				f.Name, MaskFlagValue(f.Name, value), s.env, safe)
+		}
+	})
+
+	if risky := s.riskySettings(); len(risky) > 0 && s.env != DevEnv {
+		s.logger.Warnf("risky settings in %s: %s", s.env, strings.Join(risky, ", "))
+	}
+}
+
+// flagDefault returns default value of the flag in current env
+func (s *service) flagDefault(f *flag.Flag) string {
+	if v, ok := s.envDefaults[s.env][f.Name]; ok {
+		return v
+	}
+	return f.DefValue
+}
+
+// guardedValue returns the safe value of a dev-only setting when it is not allowed,
+// value must be formatted by the flag (ex: "true", not "1")
+func (s *service) guardedValue(name, value string) (string, bool) {
+	if s.env != PrdEnv || s.allowDevFeatures {
+		return value, false
+	}
+
+	if values, ok := devOnlyFlagValues[name]; ok {
+		if safe, ok := values[value]; ok {
+			return safe, true
+		}
+		return value, false
+	}
+
+	if safe, ok := s.devOnlyFlags[name]; ok && value != safe {
+		return safe, true
+	}
+	return value, false
+}
+
+// riskySettings lists dev-only settings which are turned on
+func (s *service) riskySettings() []string {
+	var risky []string
+	s.cmdLine.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if safe, ok := s.devOnlyFlags[f.Name]; ok && value != safe {
+			risky = append(risky, fmt.Sprintf("%s=%s", f.Name, MaskFlagValue(f.Name, value)))
+		}
+		if _, ok := devOnlyFlagValues[f.Name][value]; ok {
+			risky = append(risky, fmt.Sprintf("%s=%s", f.Name, value))
+		}
+	})
+
+	if s.allowDevFeatures {
+		risky = append(risky, "app-allow-dev-features=true")
+	}
+
+	sort.Strings(risky)
+	return risky
+}
@@ -0,0 +1,127 @@
+package goservice
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestApplyEnvProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       string
+		allowDev  bool
+		args      []string
+		defaults  map[string]map[string]string
+		want      map[string]string
+		wantRisky []string
+	}{
+		{
+			name: "dev keeps dev features",
+			env:  DevEnv,
+			args: []string{"-fiber-pprof", "-log-level", "trace"},
+			want: map[string]string{"fiber-pprof": "true", "log-level": "trace", "fiber-mode": "debug"},
+			// listed in every env, only warned out of dev
+			wantRisky: []string{"fiber-mode=debug", "fiber-pprof=true", "log-level=trace"},
+		},
+		{
+			name: "prd disables dev features",
+			env:  PrdEnv,
+			args: []string{"-fiber-pprof", "-fiber-verbose-errors", "-log-level", "trace"},
+			want: map[string]string{"fiber-pprof": "false", "fiber-verbose-errors": "false", "log-level": "debug", "fiber-mode": "release"},
+		},
+		{
+			name:      "prd allows dev features on purpose",
+			env:       PrdEnv,
+			allowDev:  true,
+			args:      []string{"-fiber-pprof", "-log-level", "trace"},
+			want:      map[string]string{"fiber-pprof": "true", "log-level": "trace"},
+			wantRisky: []string{"app-allow-dev-features=true", "fiber-mode=debug", "fiber-pprof=true", "log-level=trace"},
+		},
+		{
+			name:     "env defaults",
+			env:      StgEnv,
+			defaults: map[string]map[string]string{StgEnv: {"log-level": "info", "fiber-mode": "release"}},
+			want:     map[string]string{"log-level": "info", "fiber-mode": "release"},
+		},
+		{
+			name:      "explicit values win over env defaults",
+			env:       StgEnv,
+			args:      []string{"-log-level", "debug"},
+			defaults:  map[string]map[string]string{StgEnv: {"log-level": "info"}},
+			want:      map[string]string{"log-level": "debug"},
+			wantRisky: []string{"fiber-mode=debug"},
+		},
+		{
+			name:      "risky settings of stg",
+			env:       StgEnv,
+			args:      []string{"-fiber-route-table"},
+			want:      map[string]string{"fiber-route-table": "true"},
+			wantRisky: []string{"fiber-mode=debug", "fiber-route-table=true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Bool("fiber-pprof", false, "")
+			fs.Bool("fiber-route-table", false, "")
+			fs.Bool("fiber-verbose-errors", false, "")
+			fs.String("log-level", "debug", "")
+			fs.String("fiber-mode", "debug", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			s := newTestService(t, fs, "")
+			s.env = tt.env
+			s.allowDevFeatures = tt.allowDev
+			for env, values := range tt.defaults {
+				WithEnvDefaults(env, values)(s)
+			}
+			s.applyEnvProfile()
+
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if got := s.riskySettings(); !reflect.DeepEqual(got, tt.wantRisky) {
+				t.Errorf("riskySettings() = %v, want %v", got, tt.wantRisky)
+			}
+		})
+	}
+}
+
+func TestGuardedValue(t *testing.T) {
+	tests := []struct {
+		env, name, value string
+		want             string
+		wantForced       bool
+	}{
+		{PrdEnv, "fiber-pprof", "true", "false", true},
+		{PrdEnv, "fiber-pprof", "false", "false", false},
+		{PrdEnv, "log-level", "trace", "debug", true},
+		{PrdEnv, "log-level", "info", "info", false},
+		{PrdEnv, "http-admin-pprof", "true", "false", true},
+		{PrdEnv, "my-debug", "on", "off", true},
+		{StgEnv, "fiber-pprof", "true", "true", false},
+		{DevEnv, "log-level", "trace", "trace", false},
+	}
+	for _, tt := range tests {
+		s := New(WithHTTPServer("admin", 9000, nil), WithDevOnlyFlag("my-debug", "off")).(*service)
+		s.env = tt.env
+		got, forced := s.guardedValue(tt.name, tt.value)
+		if got != tt.want || forced != tt.wantForced {
+			t.Errorf("guardedValue(%s, %s) in %s = %s, %v, want %s, %v",
+				tt.name, tt.value, tt.env, got, forced, tt.want, tt.wantForced)
+		}
+	}
+}
+
+func TestIsKnownEnv(t *testing.T) {
+	for env, want := range map[string]bool{DevEnv: true, StgEnv: true, PrdEnv: true, "prod": false, "": false} {
+		if got := isKnownEnv(env); got != want {
+			t.Errorf("isKnownEnv(%q) = %v, want %v", env, got, want)
+		}
+	}
+}
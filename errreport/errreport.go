@@ -0,0 +1,429 @@
+// Error reporting to Sentry or a JSON-lines file
+//
+// Reports are captured for 5xx responses, recovered panics and failures of
+// components. Like tracing, the reporter is registered globally, so the http
+// server middlewares capture errors without holding a reference to this service.
+// Reports are sent in the background and flushed when the service stops.
+package errreport
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/go-sdk/v2/util/requestid"
+	"github.com/baozhenglab/sdkcm"
+)
+
+const (
+	LevelFatal   = "fatal"
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelInfo    = "info"
+)
+
+// Frame of a stack trace
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+type Request struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Query     string            `json:"query,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// Breadcrumb is an event which happened before the error
+type Breadcrumb struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Category  string                 `json:"category,omitempty"`
+	Message   string                 `json:"message"`
+	Level     string                 `json:"level,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+type Report struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	// Go type of the error, ex: *errors.errorString
+	ErrorType string   `json:"error_type,omitempty"`
+	Stack     []Frame  `json:"stack,omitempty"`
+	Request   *Request `json:"request,omitempty"`
+	UserID    string   `json:"user_id,omitempty"`
+	Service   string   `json:"service,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	Env       string   `json:"env,omitempty"`
+	Hostname  string   `json:"hostname,omitempty"`
+	// ex: component of a failure, "panic" of recovered panics
+	Tags        map[string]string `json:"tags,omitempty"`
+	Breadcrumbs []Breadcrumb      `json:"breadcrumbs,omitempty"`
+}
+
+// Reporter sends reports to a backend, Report returns when ctx is done
+type Reporter interface {
+	Report(ctx context.Context, r *Report) error
+	Close() error
+}
+
+// Stack returns frames of the caller, skip 0 is the caller of Stack
+func Stack(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var res []Frame
+	for {
+		f, more := frames.Next()
+		res = append(res, Frame{Function: f.Function, File: f.File, Line: f.Line})
+		if !more {
+			break
+		}
+	}
+	return res
+}
+
+// breadcrumbs of a request, or of the process when they are not in a request
+type trail struct {
+	mu    sync.Mutex
+	max   int
+	items []Breadcrumb
+}
+
+func (t *trail) add(b Breadcrumb) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.items = append(t.items, b)
+	if len(t.items) > t.max {
+		t.items = t.items[len(t.items)-t.max:]
+	}
+}
+
+func (t *trail) list() []Breadcrumb {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Breadcrumb(nil), t.items...)
+}
+
+type trailKey struct{}
+
+// WithBreadcrumbs returns a context which collects breadcrumbs of a request
+func WithBreadcrumbs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, trailKey{}, &trail{max: maxBreadcrumbs()})
+}
+
+// AddBreadcrumb records an event of the request of ctx, or of the process
+// when ctx has no breadcrumbs. They are attached to the next report
+func AddBreadcrumb(ctx context.Context, b Breadcrumb) {
+	if b.Timestamp.IsZero() {
+		b.Timestamp = time.Now()
+	}
+	if ctx != nil {
+		if t, ok := ctx.Value(trailKey{}).(*trail); ok {
+			t.add(b)
+			return
+		}
+	}
+	processTrail.add(b)
+}
+
+var (
+	mu           sync.RWMutex
+	current      *reportService
+	processTrail = &trail{max: 100}
+)
+
+func maxBreadcrumbs() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return 100
+	}
+	return current.MaxBreadcrumbs
+}
+
+// IsEnabled reports whether a reporter is configured
+func IsEnabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current != nil
+}
+
+// Capture reports err in the background. Fields of r which are not set are
+// filled: ID, timestamp, level error, stack of the caller, service metadata
+// and breadcrumbs of ctx. r may be nil
+func Capture(ctx context.Context, err error, r *Report) {
+	mu.RLock()
+	rs := current
+	mu.RUnlock()
+	if rs == nil || err == nil {
+		return
+	}
+
+	if r == nil {
+		r = &Report{}
+	}
+	if r.ID == "" {
+		r.ID = requestid.New()
+	}
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now().UTC()
+	}
+	if r.Level == "" {
+		r.Level = LevelError
+	}
+	if r.Message == "" {
+		r.Message = ErrorMessage(err)
+	}
+	if r.ErrorType == "" {
+		r.ErrorType = errorType(err)
+	}
+	if r.Stack == nil {
+		r.Stack = Stack(1)
+	}
+	r.Service, r.Version, r.Env, r.Hostname = rs.name, rs.version, rs.env, rs.hostname
+
+	r.Breadcrumbs = processTrail.list()
+	if ctx != nil {
+		if t, ok := ctx.Value(trailKey{}).(*trail); ok {
+			r.Breadcrumbs = append(r.Breadcrumbs, t.list()...)
+		}
+		if r.Request != nil && r.Request.RequestID == "" {
+			r.Request.RequestID = requestid.FromContext(ctx)
+		}
+	}
+
+	rs.enqueue(r)
+}
+
+// ErrorMessage describes err without calling Error of sdkcm.AppError,
+// which panics when its message is not a string (ex: messages per field)
+func ErrorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var appErr sdkcm.AppError
+	if !errors.As(err, &appErr) {
+		return err.Error()
+	}
+
+	msg := fmt.Sprint(appErr.Message)
+	if root := appErr.RootError(); root != nil {
+		msg += ": " + ErrorMessage(root)
+	}
+	return msg
+}
+
+// errorType is the type of the innermost error of the chain
+func errorType(err error) string {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return fmt.Sprintf("%T", err)
+		}
+		err = next
+	}
+}
+
+type Config struct {
+	Enabled bool `json:"error_report_enabled"`
+	// Sentry DSN, ex: https://<key>@sentry.example.com/<project>
+	DSN string `json:"error_report_dsn"`
+	// JSON-lines file, one report per line
+	File           string        `json:"error_report_file"`
+	Timeout        time.Duration `json:"error_report_timeout"`
+	QueueSize      int           `json:"error_report_queue_size"`
+	MaxBreadcrumbs int           `json:"error_report_max_breadcrumbs"`
+}
+
+type reportService struct {
+	Config
+	name      string
+	version   string
+	env       string
+	hostname  string
+	logger    logger.Logger
+	reporters []Reporter
+	queueMu   sync.Mutex
+	queue     chan *Report
+	closed    bool
+	done      chan struct{}
+	// canceled when reports are not flushed in time, sends in progress are aborted
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New() *reportService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &reportService{done: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+func (rs *reportService) Name() string { return "error-report" }
+
+// SetResource sets the service which reports are sent from,
+// it is known after flags are parsed
+func (rs *reportService) SetResource(name, version, env string) {
+	rs.name, rs.version, rs.env = name, version, env
+}
+
+func (rs *reportService) InitFlags() {
+	prefix := "error-report-"
+	flag.BoolVar(&rs.Enabled, prefix+"enabled", false, "Report 5xx errors, panics and failures of components")
+	flag.StringVar(&rs.DSN, prefix+"dsn", "", "Sentry DSN to send reports to, ex: https://<key>@sentry.example.com/<project>")
+	flag.StringVar(&rs.File, prefix+"file", "", "File to append reports to as JSON lines")
+	flag.DurationVar(&rs.Timeout, prefix+"timeout", 5*time.Second, "Timeout to send a report")
+	flag.IntVar(&rs.QueueSize, prefix+"queue-size", 100, "Reports waiting to be sent, the others are dropped")
+	flag.IntVar(&rs.MaxBreadcrumbs, prefix+"max-breadcrumbs", 30, "Breadcrumbs kept per request")
+}
+
+func (rs *reportService) Configure() error {
+	rs.logger = logger.GetCurrent().GetLogger("error-report")
+
+	if !rs.Enabled {
+		return nil
+	}
+	if rs.DSN == "" && rs.File == "" {
+		return errors.New("error-report-dsn or error-report-file is required")
+	}
+
+	if rs.DSN != "" {
+		r, err := NewSentryReporter(rs.DSN, rs.Timeout)
+		if err != nil {
+			return err
+		}
+		rs.reporters = append(rs.reporters, r)
+	}
+	if rs.File != "" {
+		r, err := NewFileReporter(rs.File)
+		if err != nil {
+			return err
+		}
+		rs.reporters = append(rs.reporters, r)
+	}
+
+	rs.hostname, _ = os.Hostname()
+	rs.queue = make(chan *Report, rs.QueueSize)
+	// reports of components failed before the service starts are sent too
+	go rs.work()
+
+	mu.Lock()
+	current = rs
+	mu.Unlock()
+	return nil
+}
+
+func (rs *reportService) enqueue(r *Report) {
+	rs.queueMu.Lock()
+	defer rs.queueMu.Unlock()
+	if rs.closed {
+		return
+	}
+
+	select {
+	case rs.queue <- r:
+	default:
+		rs.logger.Warnf("queue is full, report %s is dropped: %s", r.ID, r.Message)
+	}
+}
+
+// Run does nothing, reports are sent since the service is configured
+func (rs *reportService) Run() error {
+	return nil
+}
+
+func (rs *reportService) work() {
+	defer close(rs.done)
+	dropped := 0
+	for r := range rs.queue {
+		if rs.ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		rs.send(r)
+	}
+	if dropped > 0 {
+		rs.logger.Warnf("%d reports are dropped on stop", dropped)
+	}
+}
+
+func (rs *reportService) send(r *Report) {
+	for _, reporter := range rs.reporters {
+		ctx, cancel := context.WithTimeout(rs.ctx, rs.Timeout)
+		if err := reporter.Report(ctx, r); err != nil {
+			rs.logger.Errorf("sending report %s: %v", r.ID, err)
+		}
+		cancel()
+	}
+}
+
+// Stop sends reports in the queue, then closes reporters. Reports which are
+// not sent in time are aborted, reporters must return when the context is done
+func (rs *reportService) Stop() <-chan bool {
+	c := make(chan bool)
+	go func() {
+		if rs.queue != nil {
+			mu.Lock()
+			if current == rs {
+				current = nil
+			}
+			mu.Unlock()
+
+			rs.queueMu.Lock()
+			if !rs.closed {
+				rs.closed = true
+				close(rs.queue)
+			}
+			rs.queueMu.Unlock()
+
+			select {
+			case <-rs.done:
+			case <-time.After(rs.Timeout):
+				rs.logger.Warnln("reports are not flushed in time")
+				// reporters are closed once nothing is sent with them
+				rs.cancel()
+				<-rs.done
+			}
+			rs.cancel()
+
+			for _, reporter := range rs.reporters {
+				_ = reporter.Close()
+			}
+		}
+		c <- true
+	}()
+	return c
+}
+
+// headers with credentials are not reported
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+}
+
+// FilterHeaders drops headers with credentials, names are case-insensitive
+func FilterHeaders(headers map[string]string) map[string]string {
+	res := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if !sensitiveHeaders[strings.ToLower(k)] {
+			res[k] = v
+		}
+	}
+	return res
+}
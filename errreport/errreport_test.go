@@ -0,0 +1,187 @@
+package errreport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/sdkcm"
+)
+
+// newTestService configures a service which appends reports to a file in dir
+func newTestService(t *testing.T, dir string) *reportService {
+	t.Helper()
+	logger.InitServLogger(false)
+
+	rs := New()
+	rs.Enabled = true
+	rs.File = filepath.Join(dir, "reports.jsonl")
+	rs.Timeout = time.Second
+	rs.QueueSize = 10
+	rs.MaxBreadcrumbs = 2
+	rs.SetResource("test", "1.0.0", "dev")
+	if err := rs.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+// readReports stops the service, so the queue is flushed, and reads the file
+func readReports(t *testing.T, rs *reportService) []Report {
+	t.Helper()
+	<-rs.Stop()
+
+	f, err := os.Open(rs.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var reports []Report
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Report
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("line %q is not a report: %v", scanner.Text(), err)
+		}
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+func TestCapture(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantMessage string
+		wantType    string
+	}{
+		{"error", errors.New("boom"), "boom", "*errors.errorString"},
+		{"app error", sdkcm.NewAppErr(errors.New("db down"), 500, "cannot list"), "cannot list: db down", "sdkcm.AppError"},
+		// Error of the AppError panics on messages which are not strings
+		{"app error with fields", sdkcm.AppError{StatusCode: 422, Message: map[string]string{"name": "required"}}, "map[name:required]", "sdkcm.AppError"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "errreport")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			rs := newTestService(t, dir)
+			ctx := WithBreadcrumbs(context.Background())
+			for _, msg := range []string{"a", "b", "c"} {
+				AddBreadcrumb(ctx, Breadcrumb{Message: msg})
+			}
+			Capture(ctx, tt.err, &Report{Request: &Request{Method: "GET", URL: "/users"}})
+
+			reports := readReports(t, rs)
+			if len(reports) != 1 {
+				t.Fatalf("reported %d times, want 1", len(reports))
+			}
+			r := reports[0]
+			if r.Message != tt.wantMessage || r.ErrorType != tt.wantType {
+				t.Errorf("message, type = %q, %q, want %q, %q", r.Message, r.ErrorType, tt.wantMessage, tt.wantType)
+			}
+			if r.ID == "" || r.Level != LevelError || r.Service != "test" || r.Version != "1.0.0" || r.Env != "dev" {
+				t.Errorf("report %+v is not filled", r)
+			}
+			if len(r.Stack) == 0 || r.Stack[0].Function != "github.com/baozhenglab/go-sdk/v2/errreport.TestCapture.func1" {
+				t.Errorf("stack %v, want the caller of Capture first", r.Stack)
+			}
+			// breadcrumbs of the request are kept up to the max
+			if n := len(r.Breadcrumbs); n < 2 || r.Breadcrumbs[n-2].Message != "b" || r.Breadcrumbs[n-1].Message != "c" {
+				t.Errorf("breadcrumbs = %v, want the last b and c", r.Breadcrumbs)
+			}
+		})
+	}
+}
+
+func TestCaptureDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rs := newTestService(t, dir)
+	Capture(context.Background(), nil, nil)
+	reports := readReports(t, rs)
+	// the service is stopped, reports are not captured any more
+	Capture(context.Background(), errors.New("late"), nil)
+
+	if len(reports) != 0 || IsEnabled() {
+		t.Errorf("reported %v, enabled %v, want nothing", reports, IsEnabled())
+	}
+}
+
+// slowReporter blocks reports until their context is done
+type slowReporter struct {
+	mu        sync.Mutex
+	reporting bool
+	sent      int
+	// Close is called while a report is sent
+	closedEarly bool
+}
+
+func (r *slowReporter) Report(ctx context.Context, _ *Report) error {
+	r.mu.Lock()
+	r.reporting, r.sent = true, r.sent+1
+	r.mu.Unlock()
+
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+
+	r.mu.Lock()
+	r.reporting = false
+	r.mu.Unlock()
+	return ctx.Err()
+}
+
+func (r *slowReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closedEarly = r.reporting
+	return nil
+}
+
+func TestStopAbortsSlowReports(t *testing.T) {
+	logger.InitServLogger(false)
+	reporter := &slowReporter{}
+	rs := New()
+	rs.logger = logger.GetCurrent().GetLogger("error-report")
+	rs.Timeout = 50 * time.Millisecond
+	rs.reporters = []Reporter{reporter}
+	rs.queue = make(chan *Report, 10)
+	go rs.work()
+	for i := 0; i < 3; i++ {
+		rs.enqueue(&Report{ID: strconv.Itoa(i)})
+	}
+
+	select {
+	case <-rs.Stop():
+	case <-time.After(time.Second):
+		t.Fatal("Stop doesn't return")
+	}
+	// the first report times out, the others are dropped when the flush times out
+	if reporter.sent >= 3 || reporter.closedEarly {
+		t.Errorf("sent %d reports, closed while sending %v", reporter.sent, reporter.closedEarly)
+	}
+}
+
+func TestFilterHeaders(t *testing.T) {
+	got := FilterHeaders(map[string]string{"Authorization": "Bearer x", "Cookie": "a=b", "X-Api-Key": "k", "Accept": "*/*"})
+	if len(got) != 1 || got["Accept"] != "*/*" {
+		t.Errorf("FilterHeaders = %v, want Accept only", got)
+	}
+}
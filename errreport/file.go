@@ -0,0 +1,35 @@
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// fileReporter appends reports to a file as JSON lines
+type fileReporter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewFileReporter(path string) (Reporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &fileReporter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (fr *fileReporter) Report(_ context.Context, r *Report) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.enc.Encode(r)
+}
+
+func (fr *fileReporter) Close() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.f.Close()
+}
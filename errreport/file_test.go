@@ -0,0 +1,56 @@
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reports.jsonl")
+
+	// reports of a restarted service are appended
+	for _, id := range []string{"a", "b"} {
+		reporter, err := NewFileReporter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reporter.Report(context.Background(), &Report{ID: id, Message: "boom"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := reporter.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("file has %d lines, want 2:\n%s", len(lines), data)
+	}
+	for i, id := range []string{"a", "b"} {
+		var r Report
+		if err := json.Unmarshal([]byte(lines[i]), &r); err != nil {
+			t.Fatalf("line %q is not a report: %v", lines[i], err)
+		}
+		if r.ID != id || r.Message != "boom" {
+			t.Errorf("line %d = %+v, want report %s", i, r, id)
+		}
+	}
+
+	if _, err := NewFileReporter(filepath.Join(dir, "missing", "reports.jsonl")); err == nil {
+		t.Error("NewFileReporter in a missing directory succeeded, want an error")
+	}
+}
@@ -0,0 +1,199 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const sentryClient = "go-sdk/2"
+
+// sentryReporter sends reports as events of the Sentry store API,
+// it works with Sentry and servers compatible with its protocol
+type sentryReporter struct {
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+// NewSentryReporter parses a DSN, ex: https://<key>[:<secret>]@sentry.example.com[/path]/<project>
+func NewSentryReporter(dsn string, timeout time.Duration) (Reporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %v", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid sentry dsn: public key is missing")
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	project := path[i+1:]
+	if project == "" {
+		return nil, fmt.Errorf("invalid sentry dsn: project is missing")
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+
+	return &sentryReporter{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:i], project),
+		auth:     auth,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace struct {
+		Frames []sentryFrame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+type sentryBreadcrumb struct {
+	Timestamp float64                `json:"timestamp"`
+	Category  string                 `json:"category,omitempty"`
+	Message   string                 `json:"message"`
+	Level     string                 `json:"level,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+type sentryRequest struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        map[string]string `json:"user,omitempty"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+	Exception   struct {
+		Values []sentryException `json:"values"`
+	} `json:"exception"`
+	Breadcrumbs struct {
+		Values []sentryBreadcrumb `json:"values"`
+	} `json:"breadcrumbs"`
+}
+
+func toSentryEvent(r *Report) *sentryEvent {
+	e := &sentryEvent{
+		EventID:     r.ID,
+		Timestamp:   r.Timestamp.UTC().Format(time.RFC3339),
+		Level:       r.Level,
+		Platform:    "go",
+		Logger:      r.Service,
+		ServerName:  r.Hostname,
+		Environment: r.Env,
+		Message:     r.Message,
+		Tags:        r.Tags,
+	}
+	if r.Service != "" && r.Version != "" {
+		e.Release = r.Service + "@" + r.Version
+	}
+	if r.UserID != "" {
+		e.User = map[string]string{"id": r.UserID}
+	}
+	if r.Request != nil {
+		e.Request = &sentryRequest{
+			URL:         r.Request.URL,
+			Method:      r.Request.Method,
+			QueryString: r.Request.Query,
+			Headers:     r.Request.Headers,
+			Env:         map[string]string{"REMOTE_ADDR": r.Request.IP},
+		}
+		if r.Request.RequestID != "" {
+			if e.Tags == nil {
+				e.Tags = map[string]string{}
+			}
+			e.Tags["request_id"] = r.Request.RequestID
+		}
+	}
+
+	ex := sentryException{Type: r.ErrorType, Value: r.Message}
+	// sentry frames are ordered from the outermost call
+	for i := len(r.Stack) - 1; i >= 0; i-- {
+		f := r.Stack[i]
+		ex.Stacktrace.Frames = append(ex.Stacktrace.Frames, sentryFrame{
+			Function: f.Function,
+			AbsPath:  f.File,
+			Filename: f.File,
+			Lineno:   f.Line,
+			InApp:    !strings.HasPrefix(f.Function, "runtime.") && !strings.Contains(f.File, "/pkg/mod/"),
+		})
+	}
+	e.Exception.Values = []sentryException{ex}
+
+	e.Breadcrumbs.Values = []sentryBreadcrumb{}
+	for _, b := range r.Breadcrumbs {
+		e.Breadcrumbs.Values = append(e.Breadcrumbs.Values, sentryBreadcrumb{
+			Timestamp: float64(b.Timestamp.UnixNano()) / 1e9,
+			Category:  b.Category,
+			Message:   b.Message,
+			Level:     b.Level,
+			Data:      b.Data,
+		})
+	}
+	return e
+}
+
+func (sr *sentryReporter) Report(ctx context.Context, r *Report) error {
+	body, err := json.Marshal(toSentryEvent(r))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sr.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", sr.auth)
+
+	res, err := sr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("sentry responded %s", res.Status)
+	}
+	return nil
+}
+
+func (sr *sentryReporter) Close() error {
+	sr.client.CloseIdleConnections()
+	return nil
+}
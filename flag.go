@@ -3,9 +3,12 @@ package goservice
 import (
 	"flag"
 	"fmt"
+	"log"
 	"os"
+	"path"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/facebookgo/flagenv"
 	"github.com/olekukonko/tablewriter"
@@ -39,44 +42,127 @@ func isZeroValue(f *flag.Flag, value string) bool {
 	return false
 }
 
-func getEnvName(name string) string {
+// stageFlagValue parses value by a new flag.Value of the same type as f, so the
+// value is formatted like f without writing the variable bound to f
+func stageFlagValue(f *flag.Flag, value string) (string, error) {
+	typ := reflect.TypeOf(f.Value)
+	if typ.Kind() != reflect.Ptr {
+		return "", fmt.Errorf("flag of type %s cannot be reloaded", typ)
+	}
+	v, ok := reflect.New(typ.Elem()).Interface().(flag.Value)
+	if !ok {
+		return "", fmt.Errorf("flag of type %s cannot be reloaded", typ)
+	}
+	if err := v.Set(value); err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+func getEnvName(prefix, name string) string {
 	name = strings.Replace(name, ".", "_", -1)
 	name = strings.Replace(name, "-", "_", -1)
-	if flagenv.Prefix != "" {
-		name = flagenv.Prefix + name
+	if prefix != "" {
+		name = prefix + name
 	}
 	return strings.ToUpper(name)
 }
 
+const maskedValue = "******"
+
+var (
+	sensitiveMu sync.RWMutex
+	// Flags matching one of these patterns (see path.Match) never have their
+	// values printed, the name is lower-cased before matching. Names which only
+	// contain "key", ex: ratelimit-key-prefix or keepalive, are not sensitive
+	sensitivePatterns = []string{"*secret*", "*password*", "*-key", "*api-key*", "*private-key*"}
+	sensitiveFlags    = map[string]bool{}
+)
+
+// MarkFlagSensitive registers flags by name whose values must be masked
+// in usage, sample envs and diagnostics
+func MarkFlagSensitive(names ...string) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	for _, name := range names {
+		sensitiveFlags[name] = true
+	}
+}
+
+// AddSensitiveFlagPattern registers name patterns, ex: "*dsn*", "*-token"
+func AddSensitiveFlagPattern(patterns ...string) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	for _, p := range patterns {
+		sensitivePatterns = append(sensitivePatterns, strings.ToLower(p))
+	}
+}
+
+// IsSensitiveFlag reports whether value of the flag must be masked
+func IsSensitiveFlag(name string) bool {
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	if sensitiveFlags[name] {
+		return true
+	}
+
+	lower := strings.ToLower(name)
+	for _, p := range sensitivePatterns {
+		if ok, _ := path.Match(p, lower); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskFlagValue returns value of flag that is safe to print
+func MaskFlagValue(name, value string) string {
+	if value == "" || !IsSensitiveFlag(name) {
+		return value
+	}
+	return maskedValue
+}
+
 type AppFlagSet struct {
 	*flag.FlagSet
+	envPrefix string
 }
 
-func newFlagSet(name string, fs *flag.FlagSet) *AppFlagSet {
-	fSet := &AppFlagSet{fs}
+func newFlagSet(name string, fs *flag.FlagSet, envPrefix string) *AppFlagSet {
+	// keep supporting the global prefix of flagenv
+	if envPrefix == "" {
+		envPrefix = flagenv.Prefix
+	}
+
+	fSet := &AppFlagSet{FlagSet: fs, envPrefix: envPrefix}
 	fSet.Usage = flagCustomUsage(name, fSet)
 	return fSet
 }
 
+// EnvName returns name of the env variable which the flag is read from
+func (f *AppFlagSet) EnvName(name string) string {
+	return getEnvName(f.envPrefix, name)
+}
+
 func (f *AppFlagSet) GetSampleEnvs() {
 	data := make([][]string, 0)
-	f.VisitAll(func(f *flag.Flag) {
-		if f.Name == "outenv" {
+	f.VisitAll(func(fl *flag.Flag) {
+		if fl.Name == "outenv" {
 			return
 		}
 		row := make([]string, 4)
-		nameenv := getEnvName(f.Name)
-		row[0] = strings.Split(nameenv, "_")[0]
-		row[1] = nameenv
-		row[3] = f.Usage
+		row[0] = strings.Split(getEnvName("", fl.Name), "_")[0]
+		row[1] = f.EnvName(fl.Name)
+		row[3] = fl.Usage
 
-		if !isZeroValue(f, f.DefValue) {
-			t := fmt.Sprintf("%T", f.Value)
+		if !isZeroValue(fl, fl.DefValue) {
+			defValue := MaskFlagValue(fl.Name, fl.DefValue)
+			t := fmt.Sprintf("%T", fl.Value)
 			if t == "*flag.stringValue" {
 				// put quotes on the value
-				row[2] = fmt.Sprintf("%q", f.DefValue)
+				row[2] = fmt.Sprintf("%q", defValue)
 			} else {
-				row[2] = fmt.Sprintf("%v", f.DefValue)
+				row[2] = fmt.Sprintf("%v", defValue)
 			}
 		}
 		data = append(data, row)
@@ -84,6 +170,16 @@ func (f *AppFlagSet) GetSampleEnvs() {
 	f.ShowTable(data)
 }
 
+// Values returns current value of all flags, sensitive ones are masked.
+// It is safe to use for logs and admin endpoints
+func (f *AppFlagSet) Values() map[string]string {
+	values := make(map[string]string)
+	f.VisitAll(func(fl *flag.Flag) {
+		values[fl.Name] = MaskFlagValue(fl.Name, fl.Value.String())
+	})
+	return values
+}
+
 func (f *AppFlagSet) ShowTable(data [][]string) {
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"GROUP", "NAME", "DEFAULT VALUE", "USAGE"})
@@ -94,10 +190,37 @@ func (f *AppFlagSet) ShowTable(data [][]string) {
 }
 
 func (f *AppFlagSet) Parse(args []string) {
-	flagenv.Parse()
+	if err := f.parseEnv(); err != nil {
+		log.Fatalln(err)
+	}
 	_ = f.FlagSet.Parse(args)
 }
 
+// parseEnv sets each flag which is not set explicitly from its env variable,
+// same as flagenv.Parse but never prints values of sensitive flags
+func (f *AppFlagSet) parseEnv() error {
+	explicit := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) {
+		explicit[fl.Name] = true
+	})
+
+	var err error
+	f.VisitAll(func(fl *flag.Flag) {
+		if err != nil || explicit[fl.Name] {
+			return
+		}
+		val := os.Getenv(f.EnvName(fl.Name))
+		if val == "" {
+			return
+		}
+		// set through the flag set, so it is known as explicitly set
+		if ferr := f.Set(fl.Name, val); ferr != nil {
+			err = fmt.Errorf("failed to set flag %q with value %q", fl.Name, MaskFlagValue(fl.Name, val))
+		}
+	})
+	return err
+}
+
 // inspect from PrintDefaults
 func flagCustomUsage(appname string, fSet *AppFlagSet) func() {
 	return func() {
@@ -120,15 +243,16 @@ func flagCustomUsage(appname string, fSet *AppFlagSet) func() {
 			}
 			s += usage
 			if !isZeroValue(f, f.DefValue) {
+				defValue := MaskFlagValue(f.Name, f.DefValue)
 				t := fmt.Sprintf("%T", f.Value)
 				if t == "*flag.stringValue" {
 					// put quotes on the value
-					s += fmt.Sprintf(" (default %q)", f.DefValue)
+					s += fmt.Sprintf(" (default %q)", defValue)
 				} else {
-					s += fmt.Sprintf(" (default %v)", f.DefValue)
+					s += fmt.Sprintf(" (default %v)", defValue)
 				}
 			}
-			s += fmt.Sprintf(" [$%s]", getEnvName(f.Name))
+			s += fmt.Sprintf(" [$%s]", fSet.EnvName(f.Name))
 			_, _ = fmt.Fprint(os.Stderr, s, "\n")
 		})
 	}
@@ -0,0 +1,92 @@
+package goservice
+
+import (
+	"flag"
+	"testing"
+)
+
+// restoreSensitiveFlags restores the registry after a test adds to it
+func restoreSensitiveFlags(t *testing.T) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+
+	flags := make(map[string]bool, len(sensitiveFlags))
+	for k, v := range sensitiveFlags {
+		flags[k] = v
+	}
+	patterns := append([]string(nil), sensitivePatterns...)
+	t.Cleanup(func() {
+		sensitiveMu.Lock()
+		defer sensitiveMu.Unlock()
+		sensitiveFlags, sensitivePatterns = flags, patterns
+	})
+}
+
+func TestIsSensitiveFlag(t *testing.T) {
+	restoreSensitiveFlags(t)
+	MarkFlagSensitive("oauth-client")
+	AddSensitiveFlagPattern("*-DSN")
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"jwt-secret", true},
+		{"db-password", true},
+		{"api-key", true},
+		{"stripe-api-key-live", true},
+		{"jwt-private-key-file", true},
+		{"http-tls-key", true},
+		{"JWT-SECRET", true},
+		{"oauth-client", true},
+		{"error-report-dsn", true},
+		{"fiberPort", false},
+		{"app-env", false},
+		{"oauth-client-id", false},
+		{"ratelimit-key-prefix", false},
+		{"cache-key-ttl", false},
+		{"keepalive", false},
+	}
+	for _, tt := range tests {
+		if got := IsSensitiveFlag(tt.name); got != tt.want {
+			t.Errorf("IsSensitiveFlag(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMaskFlagValue(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{"jwt-secret", "s3cr3t", maskedValue},
+		{"jwt-secret", "", ""},
+		{"app-env", "prd", "prd"},
+	}
+	for _, tt := range tests {
+		if got := MaskFlagValue(tt.name, tt.value); got != tt.want {
+			t.Errorf("MaskFlagValue(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAppFlagSetValues(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("db-password", "pass", "")
+	fs.String("db-host", "localhost", "")
+	fs.Int("port", 3000, "")
+
+	values := newFlagSet("test", fs, "").Values()
+	want := map[string]string{
+		"db-password": maskedValue,
+		"db-host":     "localhost",
+		"port":        "3000",
+	}
+	if len(values) != len(want) {
+		t.Fatalf("Values() = %v, want %v", values, want)
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("Values()[%q] = %q, want %q", name, values[name], v)
+		}
+	}
+}
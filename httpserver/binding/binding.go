@@ -0,0 +1,294 @@
+// Binding and validation of request input
+//
+// Bind fills a struct from path params (`params` tag), query (`query` tag),
+// headers (`reqHeader` tag) and body: JSON, XML, form or multipart (`form` tag),
+// then validates it by `validate` tags. Errors are AppError, so ErrorHandler
+// renders them like other errors:
+//
+//	var form CreateUserForm
+//	if err := binding.Bind(c, &form); err != nil {
+//		return err
+//	}
+package binding
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/baozhenglab/sdkcm"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/gofiber/fiber/v2"
+	"github.com/iancoleman/strcase"
+	"gopkg.in/go-playground/validator.v9"
+	en_translations "gopkg.in/go-playground/validator.v9/translations/en"
+)
+
+const (
+	TagParams = "params"
+	TagQuery  = "query"
+	TagHeader = "reqHeader"
+	TagForm   = "form"
+)
+
+var (
+	mu       sync.RWMutex
+	validate *validator.Validate
+	trans    ut.Translator
+)
+
+func init() {
+	translator := en.New()
+	trans, _ = ut.New(translator, translator).GetTranslator("en")
+
+	validate = validator.New()
+	// errors are reported by names clients send
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, tag := range []string{"json", TagForm, TagQuery, TagParams, TagHeader} {
+			name := strings.Split(f.Tag.Get(tag), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return f.Name
+	})
+	if err := en_translations.RegisterDefaultTranslations(validate, trans); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterValidation adds a custom rule, message is the error of the rule,
+// {0} is the field and {1} is the param of the rule, ex: "{0} must be a valid {1} code"
+func RegisterValidation(tag string, fn validator.Func, message string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := validate.RegisterValidation(tag, fn); err != nil {
+		return err
+	}
+	if message == "" {
+		return nil
+	}
+	return validate.RegisterTranslation(tag, trans, func(ut ut.Translator) error {
+		return ut.Add(tag, message, true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T(tag, fe.Field(), fe.Param())
+		return t
+	})
+}
+
+// Validate validates a struct by `validate` tags. Errors are a 422 AppError
+// with messages per field, keyed like sdkcm.GetErrors: snake case of field names,
+// nested fields are joined by dots, ex: address.zip_code
+func Validate(v interface{}) error {
+	mu.RLock()
+	err := validate.Struct(v)
+	mu.RUnlock()
+
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return sdkcm.ErrInvalidRequest(err)
+	}
+
+	messages := map[string][]string{}
+	for _, fe := range verrs {
+		messages[fieldPath(fe)] = append(messages[fieldPath(fe)], fe.Translate(trans))
+	}
+	return sdkcm.ErrUnprocessableEntity(messages)
+}
+
+// fieldPath is the field name with its parents, ex: address.city or items[0].unit_price
+func fieldPath(fe validator.FieldError) string {
+	segments := strings.Split(fe.StructNamespace(), ".")
+	if len(segments) > 1 {
+		// the struct itself
+		segments = segments[1:]
+	}
+	for i, s := range segments {
+		index := ""
+		if j := strings.Index(s, "["); j >= 0 {
+			s, index = s[:j], s[j:]
+		}
+		segments[i] = strcase.ToSnake(s) + index
+	}
+	return strings.Join(segments, ".")
+}
+
+// Bind binds input of the request into out, a pointer to struct, then validates it.
+// The body is bound first, then query, headers and path params, so a body
+// can't override the resource of the path
+func Bind(c *fiber.Ctx, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binding: out must be a pointer to struct, got %T", out)
+	}
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(out); err != nil {
+			return sdkcm.ErrInvalidRequest(err)
+		}
+		if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+			if err := bindFiles(c, rv.Elem()); err != nil {
+				return sdkcm.ErrInvalidRequest(err)
+			}
+		}
+	}
+
+	// fiber parsers of query and headers share a cache of struct fields
+	// which ignores the tag, so they can't be used on the same struct
+	sources := []struct {
+		tag    string
+		values func(name string) []string
+	}{
+		{TagQuery, func(name string) []string {
+			var values []string
+			for _, v := range c.Context().QueryArgs().PeekMulti(name) {
+				values = append(values, string(v))
+			}
+			return values
+		}},
+		{TagHeader, func(name string) []string {
+			return nonEmpty(string(c.Request().Header.Peek(name)))
+		}},
+		{TagParams, func(name string) []string { return nonEmpty(c.Params(name)) }},
+	}
+	for _, src := range sources {
+		if err := bindTag(rv.Elem(), src.tag, src.values); err != nil {
+			return sdkcm.ErrInvalidRequest(err)
+		}
+	}
+
+	return Validate(out)
+}
+
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
+// bindTag sets fields named by the tag, slices take all values
+// and a single value separated by comma
+func bindTag(v reflect.Value, tag string, values func(name string) []string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get(tag), ",")[0]
+		if name == "" || name == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		vals := values(name)
+		if len(vals) == 0 {
+			continue
+		}
+
+		field := v.Field(i)
+		if field.Kind() != reflect.Slice {
+			if err := setValue(field, vals[0]); err != nil {
+				return fmt.Errorf("%s %s: %v", tag, name, err)
+			}
+			continue
+		}
+
+		if len(vals) == 1 {
+			vals = strings.Split(vals[0], ",")
+		}
+		slice := reflect.MakeSlice(field.Type(), len(vals), len(vals))
+		for j, val := range vals {
+			if err := setValue(slice.Index(j), strings.TrimSpace(val)); err != nil {
+				return fmt.Errorf("%s %s: %v", tag, name, err)
+			}
+		}
+		field.Set(slice)
+	}
+	return nil
+}
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader{})
+)
+
+// bindFiles sets *multipart.FileHeader and []*multipart.FileHeader fields by `form` tags
+func bindFiles(c *fiber.Ctx, v reflect.Value) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return err
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get(TagForm), ",")[0]
+		if name == "" || name == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		files := form.File[name]
+		if len(files) == 0 {
+			continue
+		}
+		switch f.Type {
+		case fileHeaderType:
+			v.Field(i).Set(reflect.ValueOf(files[0]))
+		case fileHeadersType:
+			v.Field(i).Set(reflect.ValueOf(files))
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package binding
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+)
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	ZipCode string `json:"zipCode" validate:"required"`
+}
+
+type item struct {
+	UnitPrice int `json:"unitPrice" validate:"min=1"`
+}
+
+type order struct {
+	ID       string   `json:"id" params:"id"`
+	Page     int      `query:"page"`
+	Tags     []string `query:"tag"`
+	Tenant   string   `reqHeader:"X-Tenant"`
+	Note     string   `json:"note"`
+	FullName string   `json:"fullName" validate:"required"`
+	Address  address  `json:"address"`
+	Items    []item   `json:"items" validate:"dive"`
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		header     string
+		want       order
+		wantStatus int
+		wantKeys   []string
+	}{
+		{
+			name:   "all sources",
+			target: "/orders/1?page=2&tag=a&tag=b",
+			body:   `{"note":"n","fullName":"A","address":{"city":"c","zipCode":"z"}}`,
+			header: "t1",
+			want: order{ID: "1", Page: 2, Tags: []string{"a", "b"}, Tenant: "t1", Note: "n", FullName: "A",
+				Address: address{City: "c", ZipCode: "z"}},
+		},
+		{
+			name:   "path params win over body",
+			target: "/orders/1?tag=a,b",
+			body:   `{"id":"2","fullName":"A","address":{"city":"c","zipCode":"z"}}`,
+			want:   order{ID: "1", Tags: []string{"a", "b"}, FullName: "A", Address: address{City: "c", ZipCode: "z"}},
+		},
+		{
+			name:       "invalid query",
+			target:     "/orders/1?page=x",
+			body:       `{"fullName":"A"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid body",
+			target:     "/orders/1",
+			body:       `{"fullName":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "validation errors",
+			target:     "/orders/1",
+			body:       `{"address":{"city":"c"},"items":[{"unitPrice":0}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   []string{"address.zip_code", "full_name", "items[0].unit_price"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got order
+			var bindErr error
+			app := fiber.New()
+			app.Post("/orders/:id", func(c *fiber.Ctx) error {
+				bindErr = Bind(c, &got)
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if tt.header != "" {
+				req.Header.Set("X-Tenant", tt.header)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantStatus == 0 {
+				if bindErr != nil {
+					t.Fatalf("Bind() err = %v", bindErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Bind() = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			var appErr sdkcm.AppError
+			if !errors.As(bindErr, &appErr) || appErr.StatusCode != tt.wantStatus {
+				t.Fatalf("Bind() err = %#v, want status %d", bindErr, tt.wantStatus)
+			}
+			if tt.wantKeys == nil {
+				return
+			}
+			messages, _ := appErr.Message.(map[string][]string)
+			var keys []string
+			for k := range messages {
+				keys = append(keys, k)
+			}
+			if len(keys) != len(tt.wantKeys) {
+				t.Errorf("error keys = %v, want %v", keys, tt.wantKeys)
+			}
+			for _, k := range tt.wantKeys {
+				if len(messages[k]) == 0 {
+					t.Errorf("no error of %s in %v", k, messages)
+				}
+			}
+		})
+	}
+}
+
+func TestBindTarget(t *testing.T) {
+	app := fiber.New()
+	var err error
+	app.Get("/", func(c *fiber.Ctx) error {
+		var o order
+		err = Bind(c, o)
+		return nil
+	})
+	if _, e := app.Test(httptest.NewRequest(http.MethodGet, "/", nil)); e != nil {
+		t.Fatal(e)
+	}
+	if err == nil {
+		t.Error("Bind() of a struct value err = nil")
+	}
+}
@@ -1,14 +1,19 @@
 package httpserver
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"github.com/baozhenglab/go-sdk/v2/errreport"
 	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/go-sdk/v2/httpserver/openapi"
 	"github.com/baozhenglab/go-sdk/v2/logger"
-	"github.com/gofiber/adaptor/v2"
+	"github.com/baozhenglab/go-sdk/v2/metrics"
+	"github.com/baozhenglab/go-sdk/v2/tracing"
+	"github.com/baozhenglab/go-sdk/v2/util/requestid"
 	"github.com/gofiber/fiber/v2"
-	logfiber "github.com/gofiber/fiber/v2/middleware/logger"
-	"go.opencensus.io/plugin/ochttp"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
 	"net"
 	"net/http"
 	"strings"
@@ -17,16 +22,88 @@ import (
 )
 
 var (
-	fiberMode     string
-	fiberNoLogger bool
-	defaultPort   = 3000
+	fiberMode   string
+	defaultPort = 3000
 )
 
+// Modes of -fiber-mode, they apply to all servers. Without a mode,
+// each setting follows its flag
+const (
+	// verbose errors, request dumps and the route table printed at startup
+	ModeDebug = "debug"
+	// no internals in error responses nor stack traces in panic logs, no startup banner
+	ModeRelease = "release"
+)
+
+// Mode returns the value of -fiber-mode
+func Mode() string {
+	return fiberMode
+}
+
+// DefaultServer is the name of the server created by New, it keeps the fiber* flags
+const DefaultServer = "default"
+
+// FlagPrefix returns the prefix of flags of a server: fiber for the default
+// server, http-<server> for the others, ex: -http-admin-port
+func FlagPrefix(server string) string {
+	if server == "" || server == DefaultServer {
+		return "fiber"
+	}
+	return "http-" + server
+}
+
 type Config struct {
 	Port           int    `json:"http_port"`
 	BindAddr       string `json:"http_bind_addr"`
+	UnixSocketMode string `json:"http_unix_socket_mode"`
 	FiberNoDefault bool   `json:"http_no_default"`
 	JaegerActive   bool
+	// dev-only features, they are disabled in prd by the service
+	Pprof         bool `json:"http_pprof"`
+	RouteTable    bool `json:"http_route_table"`
+	VerboseErrors bool `json:"http_verbose_errors"`
+	// error responses, see middleware.ErrorHandlerConfig
+	ErrorFormat     string `json:"http_error_format"`
+	ProblemTypeURI  string `json:"http_problem_type_uri"`
+	TLS             TLSConfig
+	RequestIDHeader string `json:"http_request_id_header"`
+	// access logs
+	AccessLogFields     string  `json:"http_access_log_fields"`
+	AccessLogSkipPaths  string  `json:"http_access_log_skip_paths"`
+	AccessLogSampleRate float64 `json:"http_access_log_sample_rate"`
+	CORS                CORSConfig
+	// API docs
+	ServeOpenAPI       bool   `json:"http_openapi"`
+	ServeSwaggerUI     bool   `json:"http_swagger_ui"`
+	SwaggerUIAssets    string `json:"http_swagger_ui_assets"`
+	SwaggerUIIntegrity string `json:"http_swagger_ui_integrity"`
+	// timeouts and limits, see fiberConfig for how they are merged into a custom fiber.Config
+	ReadTimeout     time.Duration `json:"http_read_timeout"`
+	WriteTimeout    time.Duration `json:"http_write_timeout"`
+	IdleTimeout     time.Duration `json:"http_idle_timeout"`
+	BodyLimit       int           `json:"http_body_limit"`
+	Concurrency     int           `json:"http_concurrency"`
+	ReadBufferSize  int           `json:"http_read_buffer_size"`
+	WriteBufferSize int           `json:"http_write_buffer_size"`
+	// graceful drain when the server stops
+	ReadinessPath string        `json:"http_readiness_path"`
+	PreStopDelay  time.Duration `json:"http_pre_stop_delay"`
+	DrainTimeout  time.Duration `json:"http_drain_timeout"`
+	// POST requests of the path reload the service like SIGHUP, empty to disable
+	ReloadPath string `json:"http_reload_path"`
+	// names of flags set by ConfigWithFlags, see fiberConfig
+	setFlags map[string]bool
+}
+
+// CORSConfig of flags, lists are separated by comma
+type CORSConfig struct {
+	Enabled          bool   `json:"http_cors_enabled"`
+	AllowOrigins     string `json:"http_cors_origins"`
+	AllowMethods     string `json:"http_cors_methods"`
+	AllowHeaders     string `json:"http_cors_headers"`
+	ExposeHeaders    string `json:"http_cors_expose_headers"`
+	AllowCredentials bool   `json:"http_cors_credentials"`
+	MaxAge           int    `json:"http_cors_max_age"`
 }
 
 type FiberService interface {
@@ -39,67 +116,392 @@ type fiberService struct {
 	Config
 	isEnabled   bool
 	name        string
+	server      string
+	noLogger    bool
+	version     string
 	logger      logger.Logger
 	app         *fiber.App
 	mu          *sync.Mutex
 	handlers    []func(*fiber.App)
 	middlewares []fiber.Handler
 	config      *fiber.Config
+	// flag set of the config, nil when flags aren't bound
+	flags *flag.FlagSet
+	// custom shape of error responses, nil to follow ErrorFormat
+	errorRenderer middleware.ErrorRenderer
+	certs         *certReloader
+	inflight      *middleware.InFlight
+	// socket and open connections of the running app, nil when the server isn't listening
+	raw        net.Listener
+	listenAddr string
+	conns      *connTracker
+	// closed when the server is stopped
+	stopped chan struct{}
+	// errors of apps served by the running server, Run returns the first one
+	errs     chan error
+	reloadMu sync.Mutex
+	// reloads the service, see ReloadPath
+	reloader func() error
+	// groups and middlewares of the live app
+	routes *appRoutes
 	//registeredID  string
 	//registryAgent registry.Agent
 }
 
 func New(name string, config *fiber.Config) *fiberService {
-	return &fiberService{
+	return NewNamed(name, DefaultServer, defaultPort, config)
+}
+
+// NewNamed creates a server with its own flags, middlewares and handlers,
+// ex: an internal API or an admin server which is not exposed by the ingress.
+// port is the default of its port flag
+func NewNamed(name, server string, port int, config *fiber.Config) *fiberService {
+	fs := &fiberService{
 		name:        name,
+		server:      server,
 		mu:          &sync.Mutex{},
 		handlers:    []func(*fiber.App){},
 		middlewares: []fiber.Handler{},
 		config:      config,
+		inflight:    middleware.NewInFlight(),
 	}
+	fs.Config.Port = port
+	return fs
+}
+
+// ServerName returns name of the server, DefaultServer for the server created by New
+func (fs *fiberService) ServerName() string {
+	return fs.server
+}
+
+func (fs *fiberService) isDefault() bool {
+	return fs.server == DefaultServer
+}
+
+// SetVersion sets version of the API in OpenAPI documents
+func (fs *fiberService) SetVersion(version string) {
+	fs.version = version
 }
 
 func (fs *fiberService) Name() string {
-	return fs.name + "-fiber"
+	if fs.isDefault() {
+		return fs.name + "-fiber"
+	}
+	return fs.name + "-" + fs.server + "-fiber"
 }
 
 func (fs *fiberService) InitFlags() {
-	prefix := "fiber"
-	flag.IntVar(&fs.Config.Port, prefix+"Port", defaultPort, "fiber server Port. If 0 => get a random Port")
-	flag.StringVar(&fs.BindAddr, prefix+"addr", "", "fiber server bind address")
-	flag.StringVar(&fiberMode, "fiber-mode", "", "fiber mode")
-	flag.BoolVar(&fiberNoLogger, "fiber-no-logger", false, "disable default fiber logger middleware")
-	flag.BoolVar(&fs.Config.JaegerActive, prefix+"-jaeger-active", false, "Active jaeger")
+	prefix := FlagPrefix(fs.server)
+	if fs.isDefault() {
+		flag.StringVar(&fiberMode, "fiber-mode", "", "fiber mode: debug | release. Empty to follow other flags")
+	}
+	flag.BoolVar(&fs.noLogger, prefix+"-no-logger", false, "disable default fiber logger middleware")
+	fs.bindFlags(flag.CommandLine, &fs.Config)
+	fs.flags = flag.CommandLine
+}
+
+// bindFlags binds flags of the server config to cfg
+func (fs *fiberService) bindFlags(set *flag.FlagSet, cfg *Config) {
+	prefix := FlagPrefix(fs.server)
+	if fs.isDefault() {
+		set.IntVar(&cfg.Port, prefix+"Port", cfg.Port, "fiber server Port. If 0 => get a random Port")
+		set.StringVar(&cfg.BindAddr, prefix+"addr", "", "fiber server bind address: host | unix:///path.sock | fd://3 | fd://<name of LISTEN_FDNAMES>")
+	} else {
+		set.IntVar(&cfg.Port, prefix+"-port", cfg.Port, fs.server+" server Port. If 0 => get a random Port")
+		set.StringVar(&cfg.BindAddr, prefix+"-addr", "", fs.server+" server bind address: host | unix:///path.sock | fd://3 | fd://<name of LISTEN_FDNAMES>")
+	}
+	set.StringVar(&cfg.UnixSocketMode, prefix+"-unix-socket-mode", "0660", "File mode of the unix socket")
+	set.BoolVar(&cfg.JaegerActive, prefix+"-jaeger-active", false, "Deprecated: use -tracing-enabled. Trace requests")
+	set.BoolVar(&cfg.Pprof, prefix+"-pprof", false, "Serve pprof profiles at /debug/pprof")
+	set.BoolVar(&cfg.RouteTable, prefix+"-route-table", false, "Serve the route table at /debug/routes")
+	set.BoolVar(&cfg.VerboseErrors, prefix+"-verbose-errors", true, "Include root cause of errors in responses")
+	set.StringVar(&cfg.ErrorFormat, prefix+"-error-format", middleware.ErrorFormatNegotiate,
+		"Format of error responses: app | problem (RFC 7807) | negotiate (problem when clients accept application/problem+json)")
+	set.StringVar(&cfg.ProblemTypeURI, prefix+"-problem-type-uri", "",
+		"Base URI of problem types, codes of errors are appended. Empty uses about:blank")
+	set.StringVar(&cfg.RequestIDHeader, prefix+"-request-id-header", requestid.Header, "Header of request IDs")
+	set.StringVar(&cfg.AccessLogFields, prefix+"-access-log-fields", strings.Join(middleware.DefaultAccessLogFields, ","),
+		"Fields of access logs: status,latency,ip,method,path,route,query,bytes,referer,user_agent,request_id,user_id,hostname,protocol")
+	set.StringVar(&cfg.AccessLogSkipPaths, prefix+"-access-log-skip", "/health,/healthz,/readyz,/livez",
+		"Paths which are not logged, separated by comma")
+	set.Float64Var(&cfg.AccessLogSampleRate, prefix+"-access-log-sample", 1,
+		"Ratio of 1xx-3xx responses to be logged, from 0 to 1. Errors are always logged")
+	set.StringVar(&cfg.TLS.CertFile, prefix+"-tls-cert", "", "TLS certificate file, TLS is enabled when it is set")
+	set.StringVar(&cfg.TLS.KeyFile, prefix+"-tls-key", "", "TLS private key file")
+	set.StringVar(&cfg.TLS.ClientCAFile, prefix+"-tls-client-ca", "", "CA file to verify client certificates (mutual TLS)")
+	set.StringVar(&cfg.TLS.MinVersion, prefix+"-tls-min-version", "1.2", "Minimum TLS version: 1.0 | 1.1 | 1.2 | 1.3")
+	set.StringVar(&cfg.TLS.ClientAuth, prefix+"-tls-client-auth", "",
+		"Client auth: none | request | require | verify-if-given | require-and-verify. Default require-and-verify if client CA is set")
+	set.BoolVar(&cfg.CORS.Enabled, prefix+"-cors", false, "Handle cross-origin requests")
+	set.StringVar(&cfg.CORS.AllowOrigins, prefix+"-cors-origins", "*",
+		"Allowed origins: * | https://example.com | https://*.example.com | regex:<expression>, separated by comma")
+	set.StringVar(&cfg.CORS.AllowMethods, prefix+"-cors-methods", strings.Join(middleware.DefaultCORSMethods, ","),
+		"Allowed methods, separated by comma")
+	set.StringVar(&cfg.CORS.AllowHeaders, prefix+"-cors-headers", strings.Join(middleware.DefaultCORSHeaders, ","),
+		"Allowed request headers, separated by comma. * allows requested headers")
+	set.StringVar(&cfg.CORS.ExposeHeaders, prefix+"-cors-expose-headers", "", "Response headers exposed to browsers, separated by comma")
+	set.BoolVar(&cfg.CORS.AllowCredentials, prefix+"-cors-credentials", false, "Allow cookies and authorization headers, origins must be listed")
+	set.IntVar(&cfg.CORS.MaxAge, prefix+"-cors-max-age", 600, "Seconds preflight responses are cached by browsers")
+	set.BoolVar(&cfg.ServeOpenAPI, prefix+"-openapi", false, "Serve the OpenAPI document of routes at "+OpenAPIPath)
+	set.BoolVar(&cfg.ServeSwaggerUI, prefix+"-swagger-ui", false, "Serve Swagger UI of the OpenAPI document at "+SwaggerUIPath)
+	set.StringVar(&cfg.SwaggerUIAssets, prefix+"-swagger-ui-assets", openapi.DefaultSwaggerUIAssets,
+		"Base URL of swagger-ui-dist scripts and styles, or file:<dir> to serve them from a directory at "+SwaggerUIAssetsPath)
+	set.StringVar(&cfg.SwaggerUIIntegrity, prefix+"-swagger-ui-integrity", "",
+		"Subresource integrity of swagger-ui.css and swagger-ui-bundle.js, separated by comma")
+	set.DurationVar(&cfg.ReadTimeout, prefix+"-read-timeout", time.Second, "Max duration to read a request, 0 means no timeout")
+	set.DurationVar(&cfg.WriteTimeout, prefix+"-write-timeout", 0, "Max duration to write a response, 0 means no timeout")
+	set.DurationVar(&cfg.IdleTimeout, prefix+"-idle-timeout", 0,
+		"Max duration a keep-alive connection waits for the next request, 0 means read timeout is used")
+	set.IntVar(&cfg.BodyLimit, prefix+"-body-limit", fiber.DefaultBodyLimit, "Max size of request bodies in bytes")
+	set.IntVar(&cfg.Concurrency, prefix+"-concurrency", fiber.DefaultConcurrency, "Max number of concurrent connections")
+	set.IntVar(&cfg.ReadBufferSize, prefix+"-read-buffer-size", fiber.DefaultReadBufferSize,
+		"Buffer size to read requests in bytes, it limits the size of headers")
+	set.IntVar(&cfg.WriteBufferSize, prefix+"-write-buffer-size", fiber.DefaultWriteBufferSize, "Buffer size to write responses in bytes")
+	set.StringVar(&cfg.ReadinessPath, prefix+"-readiness-path", "/readyz",
+		"Path of the readiness probe, it responds 503 while the server is draining. Empty to disable")
+	set.StringVar(&cfg.ReloadPath, prefix+"-reload-path", "",
+		"Path of POST requests which reload the service like SIGHUP, empty to disable. Serve it on a server which is not exposed")
+	set.DurationVar(&cfg.PreStopDelay, prefix+"-pre-stop-delay", 0,
+		"Time the server stays not-ready before it stops accepting connections, so load balancers deregister it")
+	set.DurationVar(&cfg.DrainTimeout, prefix+"-drain-timeout", 15*time.Second,
+		"Time to wait for in-flight requests when the server stops, the rest are cut off")
 }
 
 func (fs *fiberService) Configure() error {
-	fs.logger = logger.GetCurrent().GetLogger("fiber")
+	// reloads keep the logger, apps which are drained still use it
+	if fs.logger == nil && fs.isDefault() {
+		fs.logger = logger.GetCurrent().GetLogger("fiber")
+	} else if fs.logger == nil {
+		fs.logger = logger.GetCurrent().GetLogger("fiber-" + fs.server)
+	}
+
+	if fiberMode != "" && fiberMode != ModeDebug && fiberMode != ModeRelease {
+		return fmt.Errorf("unknown fiber-mode %q, must be %s or %s", fiberMode, ModeDebug, ModeRelease)
+	}
 
-	// if fiberMode == "release" {
-	// 	gin.SetMode(gin.ReleaseMode)
-	// }
+	if fs.JaegerActive && !tracing.IsEnabled() {
+		fs.logger.Warnln(FlagPrefix(fs.server) + "-jaeger-active is deprecated and no exporter is configured, use -tracing-enabled")
+	}
 
 	fs.logger.Debug("init fiber engine...")
-	if fs.config == nil {
-		fs.app = fiber.New(fiber.Config{
-			ReadTimeout:  1 * time.Second,
-			ErrorHandler: middleware.ErrorHandler(fs.logger),
+	fs.mu.Lock()
+	fs.inflight = middleware.NewInFlight()
+	fs.mu.Unlock()
+
+	app, tracked, err := fs.newApp()
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	fs.app, fs.routes = app, tracked
+	fs.mu.Unlock()
+	return nil
+}
+
+// newApp creates an app with middlewares of the service. It doesn't change
+// the service, so it also builds shadow apps for route introspection
+func (fs *fiberService) newApp() (*fiber.App, *appRoutes, error) {
+	if err := middleware.ValidErrorFormat(fs.ErrorFormat); err != nil {
+		return nil, nil, fmt.Errorf("%s-error-format: %v", FlagPrefix(fs.server), err)
+	}
+	if _, _, err := openapi.ParseIntegrity(fs.SwaggerUIIntegrity); err != nil {
+		return nil, nil, fmt.Errorf("%s-swagger-ui-integrity: %v", FlagPrefix(fs.server), err)
+	}
+	app := fiber.New(fs.fiberConfig())
+	// before the first middleware, so middlewares are told apart from endpoints
+	tracked := trackRoutes(app)
+
+	// outermost, so panics of the other middlewares are recovered as well.
+	// It is installed even without the default middlewares, a panic must not crash the server
+	app.Use(middleware.Recovery(logger.GetCurrent().GetLogger("recovery"), middleware.RecoveryConfig{NoStack: fiberMode == ModeRelease}))
+
+	// every request is counted, so the drain waits for them
+	fs.mu.Lock()
+	inflight := fs.inflight
+	fs.mu.Unlock()
+	app.Use(inflight.Handler)
+
+	if !fs.FiberNoDefault {
+		app.Use(middleware.RequestID(fs.RequestIDHeader))
+	}
+
+	if errreport.IsEnabled() {
+		app.Use(middleware.Breadcrumbs())
+	}
+
+	if fiberMode == ModeDebug {
+		app.Use(middleware.DumpRequests(logger.GetCurrent().GetLogger("dump")))
+	}
+
+	// preflight requests are answered before they are traced, limited or authorized
+	if fs.CORS.Enabled {
+		cors, err := middleware.CORS(middleware.CORSConfig{
+			AllowOrigins:     splitList(fs.CORS.AllowOrigins),
+			AllowMethods:     splitList(fs.CORS.AllowMethods),
+			AllowHeaders:     splitList(fs.CORS.AllowHeaders),
+			ExposeHeaders:    splitList(fs.CORS.ExposeHeaders),
+			AllowCredentials: fs.CORS.AllowCredentials,
+			MaxAge:           fs.CORS.MaxAge,
 		})
-	} else {
-		fs.app = fiber.New(*fs.config)
+		if err != nil {
+			return nil, nil, err
+		}
+		app.Use(cors)
+	}
+
+	if tracing.IsEnabled() || fs.JaegerActive {
+		app.Use(middleware.Tracing())
+	}
+
+	if metrics.IsEnabled() {
+		app.Use(middleware.Metrics(metrics.Registry(), fs.server, metrics.Path()))
 	}
 
 	if !fs.FiberNoDefault {
-		if !fiberNoLogger {
-			fs.app.Use(logfiber.New())
+		if !fs.noLogger {
+			app.Use(middleware.AccessLog(logger.GetCurrent().GetLogger("access"), middleware.AccessLogConfig{
+				Fields:     splitList(fs.AccessLogFields),
+				SkipPaths:  splitList(fs.AccessLogSkipPaths),
+				SampleRate: fs.AccessLogSampleRate,
+			}))
 		}
-		//gs.router.Use(gin.Recovery())
-		fs.app.Use(middleware.PanicLogger())
+	}
+	// errors are rendered once, before the middlewares above read the status
+	app.Use(middleware.RenderErrors())
+
+	if fs.Pprof {
+		app.Use(pprof.New())
 	}
 	for _, m := range fs.middlewares {
-		fs.app.Use(m)
+		app.Use(m)
 	}
-	return nil
+	return app, tracked, nil
+}
+
+// fiberConfig merges timeouts and limits of flags into the custom fiber.Config:
+// flags set by command line, env or ConfigWithFlags win, the others only fill
+// fields which the custom config leaves zero. ErrorHandler is used unless the config has one
+func (fs *fiberService) fiberConfig() fiber.Config {
+	var config fiber.Config
+	if fs.config != nil {
+		config = *fs.config
+	}
+
+	set := map[string]bool{}
+	if fs.flags != nil {
+		fs.flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	}
+	for name := range fs.setFlags {
+		set[name] = true
+	}
+	prefix := FlagPrefix(fs.server) + "-"
+
+	for _, d := range []struct {
+		flag  string
+		value time.Duration
+		field *time.Duration
+	}{
+		{"read-timeout", fs.ReadTimeout, &config.ReadTimeout},
+		{"write-timeout", fs.WriteTimeout, &config.WriteTimeout},
+		{"idle-timeout", fs.IdleTimeout, &config.IdleTimeout},
+	} {
+		if set[prefix+d.flag] || *d.field == 0 {
+			*d.field = d.value
+		}
+	}
+
+	for _, n := range []struct {
+		flag  string
+		value int
+		field *int
+	}{
+		{"body-limit", fs.BodyLimit, &config.BodyLimit},
+		{"concurrency", fs.Concurrency, &config.Concurrency},
+		{"read-buffer-size", fs.ReadBufferSize, &config.ReadBufferSize},
+		{"write-buffer-size", fs.WriteBufferSize, &config.WriteBufferSize},
+	} {
+		if set[prefix+n.flag] || *n.field == 0 {
+			*n.field = n.value
+		}
+	}
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = middleware.ErrorHandler(fs.logger, middleware.ErrorHandlerConfig{
+			Verbose:        fs.verboseErrors(),
+			Format:         fs.ErrorFormat,
+			ProblemTypeURI: fs.ProblemTypeURI,
+			Renderer:       fs.errorRenderer,
+		})
+	}
+	// prefork children would print a banner each
+	if fiberMode == ModeRelease {
+		config.DisableStartupMessage = true
+	}
+	return config
+}
+
+// verboseErrors reports whether internals are included in error responses, modes override the flag
+func (fs *fiberService) verboseErrors() bool {
+	switch fiberMode {
+	case ModeDebug:
+		return true
+	case ModeRelease:
+		return false
+	}
+	return fs.VerboseErrors
+}
+
+// register adds routes of handlers and built-in endpoints to the app
+func (fs *fiberService) register(app *fiber.App, tracked *appRoutes) {
+	for _, hdl := range fs.handlers {
+		hdl(app)
+	}
+
+	if fs.ReadinessPath != "" {
+		app.Get(fs.ReadinessPath, fs.readiness)
+	}
+
+	if fs.RouteTable {
+		app.Get("/debug/routes", fs.routeTable)
+	}
+
+	if fs.ReloadPath != "" && fs.reloader != nil {
+		app.Post(fs.ReloadPath, fs.reload)
+	}
+
+	if fs.ServeOpenAPI || fs.ServeSwaggerUI {
+		app.Get(OpenAPIPath, fs.openAPI)
+	}
+	if fs.ServeSwaggerUI {
+		app.Get(SwaggerUIPath, fs.swaggerUI)
+		if dir, ok := swaggerUIDir(fs.SwaggerUIAssets); ok {
+			app.Static(SwaggerUIAssetsPath, dir)
+		}
+	}
+
+	if metrics.ServedBy(fs.server) {
+		metricsHandler := fasthttpadaptor.NewFastHTTPHandler(metrics.Handler())
+		app.Get(metrics.Path(), func(c *fiber.Ctx) error {
+			metricsHandler(c.Context())
+			return nil
+		})
+	}
+
+	// after all routes, so only requests which no route matches reach it
+	app.Use(middleware.Unmatched())
+	tracked.setRegistered()
+}
+
+// splitList splits a comma separated flag value
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
 }
 
 func formatBindAddr(s string, p int) string {
@@ -110,57 +512,116 @@ func formatBindAddr(s string, p int) string {
 }
 
 func (fs *fiberService) Run() error {
-	if !fs.isEnabled {
+	// a server without handlers still runs to expose metrics, ex: an admin server
+	if !fs.isEnabled && !metrics.ServedBy(fs.server) {
 		return nil
 	}
 
+	// reloads wait until the server is listening, its config isn't changed meanwhile
+	fs.reloadMu.Lock()
 	if err := fs.Configure(); err != nil {
+		fs.reloadMu.Unlock()
 		return err
 	}
 
-	for _, hdl := range fs.handlers {
-		hdl(fs.app)
+	fs.register(fs.app, fs.routes)
+
+	if fiberMode == ModeDebug && !fiber.IsChild() {
+		fs.logRoutes()
 	}
 
-	addr := formatBindAddr(fs.BindAddr, fs.Config.Port)
-	fs.logger.Debugf("start listen tcp %s...", addr)
-	lis, err := net.Listen("tcp", addr)
+	fs.logger.Debugf("start listen %s...", fs.URI())
+	raw, err := fs.openListener(nil, "")
 	if err != nil {
 		fs.logger.Fatalf("failed to listen: %v", err)
 	}
 
-	fs.Config.Port = getPort(lis)
+	lis, conns, certs, err := fs.wrapListener(raw)
+	if err != nil {
+		fs.reloadMu.Unlock()
+		_ = raw.Close()
+		return err
+	}
 
-	fs.logger.Infof("listen on %s...", lis.Addr().String())
-	if fs.Config.JaegerActive == false {
-		fs.logger.Infoln("Running server no tracing")
-		err = fs.app.Listener(lis)
+	errs, stopped := make(chan error, 1), make(chan struct{})
+	fs.mu.Lock()
+	fs.raw, fs.listenAddr, fs.conns, fs.certs = raw, fs.uri(), conns, certs
+	fs.stopped, fs.errs = stopped, errs
+	app := fs.app
+	fs.mu.Unlock()
+	fs.reloadMu.Unlock()
 
-		if err != nil && err == http.ErrServerClosed {
-			return nil
-		}
+	// apps are swapped by reloads, Run returns when the server is stopped
+	go fs.serve(app, lis, errs)
+	select {
+	case err := <-errs:
 		return err
+	case <-stopped:
+		return nil
 	}
-	och := &ochttp.Handler{
-		Handler: adaptor.FiberApp(fs.app),
+}
+
+func (fs *fiberService) serve(app *fiber.App, lis net.Listener, errs chan<- error) {
+	fs.logger.Infof("listen on %s...", lis.Addr().String())
+	if err := app.Listener(lis); err != nil && err != http.ErrServerClosed {
+		select {
+		case errs <- err:
+		default:
+		}
 	}
-	var httpServe = &myHttpServer{
-		Server: http.Server{
-			Handler: och,
-		},
+}
+
+// openListener listens on the bind address. The socket of the running app is
+// shared when the address is unchanged, so reloads don't refuse connections
+func (fs *fiberService) openListener(running net.Listener, runningAddr string) (net.Listener, error) {
+	cfg := fs.GetConfig()
+	if running != nil && runningAddr == cfg.uri() {
+		return dupListener(running)
 	}
-	fs.logger.Infoln("Running server have tracing")
-	err = httpServe.Serve(lis)
-	if err != nil && err == http.ErrServerClosed {
-		return nil
+
+	socketMode, err := parseFileMode(cfg.UnixSocketMode)
+	if err != nil {
+		return nil, err
+	}
+
+	lis, err := listen(cfg.BindAddr, cfg.Port, socketMode)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	fs.Config.Port = getPort(lis)
+	fs.mu.Unlock()
+	return lis, nil
+}
+
+// wrapListener adds keep-alive, tracking of connections and TLS to a socket
+func (fs *fiberService) wrapListener(raw net.Listener) (net.Listener, *connTracker, *certReloader, error) {
+	lis := raw
+	if tcp, ok := raw.(*net.TCPListener); ok {
+		lis = tcpKeepAliveListener{tcp}
+	}
+	conns := newConnTracker(lis)
+
+	if !fs.TLS.Enabled() {
+		return conns, conns, nil, nil
+	}
+
+	certs, err := newCertReloader(fs.TLS, fs.logger)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	return err
+	go certs.watch()
+	fs.logger.Infoln("TLS is enabled")
+	return certs.listener(conns), conns, certs, nil
 }
 
+// getPort returns port of a TCP listener, 0 for unix sockets
 func getPort(lis net.Listener) int {
-	addr := lis.Addr()
-	tcp, _ := net.ResolveTCPAddr(addr.Network(), addr.String())
-	return tcp.Port
+	if tcp, ok := lis.Addr().(*net.TCPAddr); ok {
+		return tcp.Port
+	}
+	return 0
 }
 
 func (fs *fiberService) Port() int {
@@ -172,16 +633,97 @@ func (fs *fiberService) Port() int {
 func (fs *fiberService) Stop() <-chan bool {
 	c := make(chan bool)
 	go func() {
-		if fs.app != nil {
-			fs.app.Shutdown()
+		fs.reloadMu.Lock()
+		defer fs.reloadMu.Unlock()
+
+		fs.mu.Lock()
+		app, conns, inflight, certs, stopped := fs.app, fs.conns, fs.inflight, fs.certs, fs.stopped
+		delay, timeout := fs.PreStopDelay, fs.DrainTimeout
+		fs.raw, fs.conns, fs.certs, fs.stopped = nil, nil, nil, nil
+		fs.mu.Unlock()
+
+		if app != nil && conns != nil {
+			fs.drain(app, conns, inflight, delay, timeout)
+		}
+		if certs != nil {
+			certs.stop()
+		}
+		if stopped != nil {
+			close(stopped)
 		}
 		c <- true
 	}()
 	return c
 }
 
+// drain marks the app not-ready, waits the delay for load balancers
+// to deregister it, stops accepting connections and waits for in-flight
+// requests up to the timeout. Remaining connections are closed
+func (fs *fiberService) drain(app *fiber.App, conns *connTracker, inflight *middleware.InFlight, delay, timeout time.Duration) {
+	inflight.Drain()
+	if delay > 0 {
+		fs.logger.Infof("draining, not ready for %s before closing the listener...", delay)
+		time.Sleep(delay)
+	}
+
+	// Shutdown closes the listener and idle connections, then waits for
+	// the others without a limit
+	done := make(chan struct{})
+	go func() {
+		_ = app.Shutdown()
+		close(done)
+	}()
+
+	if n := inflight.Wait(timeout); n > 0 {
+		fs.logger.Warnf("drain timeout %s is exceeded, %d in-flight requests are cut off", timeout, n)
+	} else {
+		fs.logger.Infoln("in-flight requests are drained")
+	}
+
+	conns.closeAll()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+}
+
+// Draining reports whether the server is stopping, it is not ready for new requests
+func (fs *fiberService) Draining() bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.inflight.Draining()
+}
+
+// SetReloader sets the function called by POST requests of ReloadPath
+func (fs *fiberService) SetReloader(reload func() error) {
+	fs.reloader = reload
+}
+
+func (fs *fiberService) reload(c *fiber.Ctx) error {
+	if err := fs.reloader(); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (fs *fiberService) readiness(c *fiber.Ctx) error {
+	if fs.Draining() {
+		return c.Status(fiber.StatusServiceUnavailable).SendString("draining")
+	}
+	return c.SendString("ok")
+}
+
 func (fs *fiberService) URI() string {
-	return formatBindAddr(fs.BindAddr, fs.Config.Port)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.uri()
+}
+
+func (cfg *Config) uri() string {
+	if strings.HasPrefix(cfg.BindAddr, UnixScheme) || strings.HasPrefix(cfg.BindAddr, FDScheme) {
+		return cfg.BindAddr
+	}
+	return formatBindAddr(cfg.BindAddr, cfg.Port)
 }
 
 func (fs *fiberService) AddHandler(hdl func(*fiber.App)) {
@@ -193,24 +735,245 @@ func (fs *fiberService) AddMiddleware(hdl fiber.Handler) {
 	fs.middlewares = append(fs.middlewares, hdl)
 }
 
+// SetErrorRenderer sets a custom shape of error responses of this server,
+// it must be called before the server is configured
+func (fs *fiberService) SetErrorRenderer(r middleware.ErrorRenderer) {
+	fs.errorRenderer = r
+}
+
+// Reload applies a new config without dropping connections: a new app starts
+// listening, sharing the socket when the address is unchanged, then the old
+// app is drained. When the server isn't running, the config is used by Run
 func (fs *fiberService) Reload(config Config) error {
+	fs.reloadMu.Lock()
+	defer fs.reloadMu.Unlock()
+
+	fs.mu.Lock()
+	prev := fs.Config
+	oldApp, oldRoutes, oldInflight := fs.app, fs.routes, fs.inflight
+	oldRaw, oldAddr, oldConns, oldCerts := fs.raw, fs.listenAddr, fs.conns, fs.certs
 	fs.Config = config
-	<-fs.Stop()
-	return fs.Run()
+	fs.mu.Unlock()
+
+	if oldConns == nil {
+		return nil
+	}
+
+	rollback := func(err error) error {
+		fs.mu.Lock()
+		fs.Config = prev
+		fs.app, fs.routes, fs.inflight = oldApp, oldRoutes, oldInflight
+		fs.mu.Unlock()
+		fs.logger.Errorln("reloading failed, keep the running server:", err)
+		return err
+	}
+
+	raw, err := fs.openListener(oldRaw, oldAddr)
+	if err != nil {
+		return rollback(err)
+	}
+	lis, conns, certs, err := fs.wrapListener(raw)
+	if err != nil {
+		_ = raw.Close()
+		return rollback(err)
+	}
+	if err := fs.Configure(); err != nil {
+		_ = raw.Close()
+		if certs != nil {
+			certs.stop()
+		}
+		return rollback(err)
+	}
+	fs.register(fs.app, fs.routes)
+
+	fs.mu.Lock()
+	fs.raw, fs.listenAddr, fs.conns, fs.certs = raw, fs.uri(), conns, certs
+	app, errs := fs.app, fs.errs
+	fs.mu.Unlock()
+
+	// the shared unix socket is removed by the new listener only
+	if ul, ok := oldRaw.(*net.UnixListener); ok && fs.listenAddr == oldAddr {
+		ul.SetUnlinkOnClose(false)
+		if nl, ok := raw.(*net.UnixListener); ok {
+			nl.SetUnlinkOnClose(true)
+		}
+	}
+
+	// errors of the new app stop Run like errors of the first one
+	go fs.serve(app, lis, errs)
+	fs.logger.Infof("reloaded, draining the previous app...")
+	go func() {
+		fs.drain(oldApp, oldConns, oldInflight, 0, prev.DrainTimeout)
+		if oldCerts != nil {
+			oldCerts.stop()
+		}
+	}()
+	return nil
 }
 
 func (fs *fiberService) GetConfig() Config {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 	return fs.Config
 }
 
+// ConfigWithFlags returns the config with new values of its flags, ex: dynamic
+// flags reloaded from env files. Flags of other components are ignored, the
+// running server is unchanged until the config is passed to Reload
+func (fs *fiberService) ConfigWithFlags(values map[string]string) (Config, error) {
+	cfg := fs.GetConfig()
+	current := cfg
+	set := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	fs.bindFlags(set, &cfg)
+	// binding resets fields to defaults of flags
+	cfg = current
+
+	// the map is shared by copies of the config, it is replaced instead of changed
+	setFlags := make(map[string]bool, len(cfg.setFlags)+len(values))
+	for name := range cfg.setFlags {
+		setFlags[name] = true
+	}
+	for name, value := range values {
+		if set.Lookup(name) == nil {
+			continue
+		}
+		if err := set.Set(name, value); err != nil {
+			return Config{}, fmt.Errorf("flag %s: %v", name, err)
+		}
+		setFlags[name] = true
+	}
+	cfg.setFlags = setFlags
+	return cfg, nil
+}
+
 func (fs *fiberService) IsRunning() bool {
 	return fs.app != nil
 }
 
+// introspectedApp returns the live app when its routes are registered,
+// otherwise a shadow app with the same routes
+func (fs *fiberService) introspectedApp() (*fiber.App, *appRoutes, error) {
+	fs.mu.Lock()
+	app, tracked := fs.app, fs.routes
+	fs.mu.Unlock()
+	if tracked != nil && tracked.isRegistered() {
+		return app, tracked, nil
+	}
+
+	app, tracked, err := fs.newApp()
+	if err != nil {
+		return nil, nil, err
+	}
+	fs.register(app, tracked)
+	return app, tracked, nil
+}
+
+// Routes returns the route stack, it doesn't change the running app
 func (fs *fiberService) Routes() [][]*fiber.Route {
-	fs.app = fiber.New()
-	for _, hdl := range fs.handlers {
-		hdl(fs.app)
+	app, _, err := fs.introspectedApp()
+	if err != nil {
+		return nil
+	}
+	return app.Stack()
+}
+
+// RouteInfos describes routes with their group, middlewares and auth requirement
+func (fs *fiberService) RouteInfos() ([]RouteInfo, error) {
+	app, tracked, err := fs.introspectedApp()
+	if err != nil {
+		return nil, err
+	}
+	return describeRoutes(app.Stack(), tracked), nil
+}
+
+// logRoutes prints the route table of the app, it is used by debug mode
+func (fs *fiberService) logRoutes() {
+	routes, err := fs.RouteInfos()
+	if err != nil {
+		fs.logger.Errorln("describing routes:", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	_ = WriteRoutes(&buf, routes, RouteFormatTable)
+	fs.logger.Infof("routes:\n%s", buf.String())
+}
+
+// routeTable lists routes of the running app, ?format=json|csv|table
+func (fs *fiberService) routeTable(c *fiber.Ctx) error {
+	routes, err := fs.RouteInfos()
+	if err != nil {
+		return err
+	}
+
+	switch format := c.Query("format", RouteFormatJSON); format {
+	case RouteFormatJSON:
+		return c.JSON(routes)
+	case RouteFormatCSV:
+		c.Type("csv")
+		return WriteRoutes(c, routes, format)
+	case RouteFormatTable:
+		c.Type("txt")
+		return WriteRoutes(c, routes, format)
+	}
+	return fiber.NewError(fiber.StatusBadRequest, "unsupported format")
+}
+
+// Paths of API docs
+const (
+	OpenAPIPath         = "/openapi.json"
+	SwaggerUIPath       = "/docs"
+	SwaggerUIAssetsPath = SwaggerUIPath + "/assets"
+)
+
+// OpenAPI generates the OpenAPI document of routes, it doesn't change the running app
+func (fs *fiberService) OpenAPI() (*openapi.Document, error) {
+	app, tracked, err := fs.introspectedApp()
+	if err != nil {
+		return nil, err
+	}
+
+	version := fs.version
+	if version == "" {
+		version = "0.0.0"
+	}
+	return openapi.Generate(app, tracked.IsMiddleware, openapi.Info{Title: fs.title(), Version: version},
+		OpenAPIPath, SwaggerUIPath, SwaggerUIAssetsPath, metrics.Path(), fs.GetConfig().ReadinessPath, fs.GetConfig().ReloadPath), nil
+}
+
+// title of API docs, named servers are told apart by their name
+func (fs *fiberService) title() string {
+	if fs.isDefault() {
+		return fs.name
+	}
+	return fs.name + " (" + fs.server + ")"
+}
+
+func (fs *fiberService) openAPI(c *fiber.Ctx) error {
+	doc, err := fs.OpenAPI()
+	if err != nil {
+		return err
+	}
+	return c.JSON(doc)
+}
+
+func (fs *fiberService) swaggerUI(c *fiber.Ctx) error {
+	cfg := fs.GetConfig()
+	ui := openapi.SwaggerUI{Title: fs.title(), SpecURL: OpenAPIPath, Assets: cfg.SwaggerUIAssets}
+	if _, ok := swaggerUIDir(cfg.SwaggerUIAssets); ok {
+		ui.Assets = SwaggerUIAssetsPath
+	}
+	// validated when the app is created
+	ui.CSSIntegrity, ui.JSIntegrity, _ = openapi.ParseIntegrity(cfg.SwaggerUIIntegrity)
+
+	c.Type("html")
+	return openapi.WriteSwaggerUI(c, ui)
+}
+
+// swaggerUIDir returns the directory of file:<dir> assets
+func swaggerUIDir(assets string) (string, bool) {
+	if !strings.HasPrefix(assets, "file:") {
+		return "", false
 	}
-	return fs.app.Stack()
+	return strings.TrimPrefix(assets, "file:"), true
 }
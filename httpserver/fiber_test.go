@@ -0,0 +1,355 @@
+package httpserver
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestServer returns a configured server, its config has defaults of flags and args
+func newTestServer(t *testing.T, server string, args ...string) *fiberService {
+	t.Helper()
+	logger.InitServLogger(false)
+
+	fs := NewNamed("test", server, 0, nil)
+	fs.noLogger = true
+	set := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	fs.bindFlags(set, &fs.Config)
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// get requests the path of the registered app, it returns status and body
+func get(t *testing.T, app *fiber.App, path string) (int, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestConfigWithFlags(t *testing.T) {
+	fs := NewNamed("test", "admin", 9000, nil)
+	fs.Config.ReadTimeout = 3 * time.Second
+	fs.Config.CORS.AllowOrigins = "https://a.example.com"
+
+	cfg, err := fs.ConfigWithFlags(map[string]string{
+		"http-admin-port":         "9100",
+		"http-admin-cors-origins": "https://b.example.com",
+		"fiberPort":               "1234",
+		"log-level":               "debug",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Port != 9100 || cfg.CORS.AllowOrigins != "https://b.example.com" {
+		t.Errorf("flags are not applied: port=%d origins=%s", cfg.Port, cfg.CORS.AllowOrigins)
+	}
+	// fields without new values keep the current config, not defaults of flags
+	if cfg.ReadTimeout != 3*time.Second {
+		t.Errorf("ReadTimeout = %s, want 3s", cfg.ReadTimeout)
+	}
+	// the running config is changed by Reload only
+	if fs.Config.Port != 9000 || fs.Config.CORS.AllowOrigins != "https://a.example.com" {
+		t.Errorf("running config changed: %+v", fs.Config)
+	}
+
+	if _, err := fs.ConfigWithFlags(map[string]string{"http-admin-port": "x"}); err == nil {
+		t.Error("invalid value is accepted")
+	}
+}
+
+func TestFlagPrefix(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"", "fiber"},
+		{DefaultServer, "fiber"},
+		{"admin", "http-admin"},
+	}
+	for _, tt := range tests {
+		if got := FlagPrefix(tt.server); got != tt.want {
+			t.Errorf("FlagPrefix(%q) = %q, want %q", tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestNamedServers(t *testing.T) {
+	// flags of servers don't collide on one flag set
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	def, admin := New("test", nil), NewNamed("test", "admin", 9000, nil)
+	def.bindFlags(set, &def.Config)
+	admin.bindFlags(set, &admin.Config)
+	if err := set.Parse([]string{"-fiberPort", "8000", "-http-admin-addr", "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if def.Config.Port != 8000 || admin.Config.Port != 9000 || admin.BindAddr != "127.0.0.1" || def.BindAddr != "" {
+		t.Errorf("ports = %d, %d and addrs = %q, %q", def.Config.Port, admin.Config.Port, def.BindAddr, admin.BindAddr)
+	}
+
+	tests := []struct {
+		server   string
+		name     string
+		title    string
+		path     string
+		notFound string
+	}{
+		{DefaultServer, "test-fiber", "test", "/users", "/stats"},
+		{"admin", "test-admin-fiber", "test (admin)", "/stats", "/users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			fs := newTestServer(t, tt.server)
+			if fs.ServerName() != tt.server || fs.Name() != tt.name || fs.title() != tt.title {
+				t.Errorf("names = %s, %s, %s", fs.ServerName(), fs.Name(), fs.title())
+			}
+
+			// handlers and middlewares belong to their server
+			path := tt.path
+			fs.AddMiddleware(func(c *fiber.Ctx) error {
+				c.Set("X-Server", tt.server)
+				return c.Next()
+			})
+			fs.AddHandler(func(app *fiber.App) {
+				app.Get(path, func(c *fiber.Ctx) error { return c.SendString(c.GetRespHeader("X-Server")) })
+			})
+			// middlewares are installed when the app is created
+			if err := fs.Configure(); err != nil {
+				t.Fatal(err)
+			}
+			fs.register(fs.app, fs.routes)
+
+			if status, body := get(t, fs.app, tt.path); status != http.StatusOK || body != tt.server {
+				t.Errorf("GET %s = %d %q, want 200 %q", tt.path, status, body, tt.server)
+			}
+			if status, _ := get(t, fs.app, tt.notFound); status != http.StatusNotFound {
+				t.Errorf("GET %s = %d, want 404", tt.notFound, status)
+			}
+		})
+	}
+}
+
+func TestFiberConfig(t *testing.T) {
+	logger.InitServLogger(false)
+	custom := &fiber.Config{ReadTimeout: 5 * time.Second, BodyLimit: 1024, Concurrency: 10}
+
+	tests := []struct {
+		name   string
+		config *fiber.Config
+		// flags given on the command line
+		flags map[string]string
+		// flags given to ConfigWithFlags, ex: reloaded from env files
+		reloaded        map[string]string
+		wantRead        time.Duration
+		wantWrite       time.Duration
+		wantBodyLimit   int
+		wantConcurrency int
+	}{
+		{
+			name:            "defaults of flags",
+			wantRead:        time.Second,
+			wantBodyLimit:   fiber.DefaultBodyLimit,
+			wantConcurrency: fiber.DefaultConcurrency,
+		},
+		{
+			name:            "flags",
+			flags:           map[string]string{"read-timeout": "3s", "write-timeout": "4s", "body-limit": "2048"},
+			wantRead:        3 * time.Second,
+			wantWrite:       4 * time.Second,
+			wantBodyLimit:   2048,
+			wantConcurrency: fiber.DefaultConcurrency,
+		},
+		{
+			name:            "custom config keeps its values",
+			config:          custom,
+			wantRead:        5 * time.Second,
+			wantBodyLimit:   1024,
+			wantConcurrency: 10,
+		},
+		{
+			name:            "given flags override custom config",
+			config:          custom,
+			flags:           map[string]string{"body-limit": "4096", "write-timeout": "2s"},
+			wantRead:        5 * time.Second,
+			wantWrite:       2 * time.Second,
+			wantBodyLimit:   4096,
+			wantConcurrency: 10,
+		},
+		{
+			name:            "reloaded flags override custom config",
+			config:          custom,
+			flags:           map[string]string{"write-timeout": "2s"},
+			reloaded:        map[string]string{"body-limit": "4096", "read-timeout": "3s"},
+			wantRead:        3 * time.Second,
+			wantWrite:       2 * time.Second,
+			wantBodyLimit:   4096,
+			wantConcurrency: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewNamed("test", "limits", 0, tt.config)
+			set := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+			fs.bindFlags(set, &fs.Config)
+			fs.flags = set
+			for name, value := range tt.flags {
+				if err := set.Set(FlagPrefix(fs.server)+"-"+name, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.reloaded != nil {
+				values := map[string]string{}
+				for name, value := range tt.reloaded {
+					values[FlagPrefix(fs.server)+"-"+name] = value
+				}
+				cfg, err := fs.ConfigWithFlags(values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fs.Config = cfg
+			}
+
+			got := fs.fiberConfig()
+			if got.ReadTimeout != tt.wantRead || got.WriteTimeout != tt.wantWrite ||
+				got.BodyLimit != tt.wantBodyLimit || got.Concurrency != tt.wantConcurrency {
+				t.Errorf("config = read %s, write %s, body %d, concurrency %d", got.ReadTimeout, got.WriteTimeout, got.BodyLimit, got.Concurrency)
+			}
+			if got.ErrorHandler == nil {
+				t.Error("config has no error handler")
+			}
+		})
+	}
+	// the custom config is not changed
+	if custom.BodyLimit != 1024 || custom.WriteTimeout != 0 {
+		t.Errorf("custom config changed: %+v", custom)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	fs := newTestServer(t, "body", "-http-body-body-limit", "16")
+	fs.AddHandler(func(app *fiber.App) {
+		app.Post("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	})
+	fs.register(fs.app, fs.routes)
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"small", http.StatusOK},
+		{strings.Repeat("x", 32), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		resp, err := fs.app.Test(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+		// fasthttp answers 413 and reports the error of the connection
+		if err != nil && tt.want == http.StatusRequestEntityTooLarge && strings.Contains(err.Error(), "body size exceeds") {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("body of %d bytes: status = %d, want %d", len(tt.body), resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestFiberMode(t *testing.T) {
+	logger.InitServLogger(false)
+	defer func(mode string) { fiberMode = mode }(fiberMode)
+
+	tests := []struct {
+		mode        string
+		verbose     bool
+		wantVerbose bool
+		wantBanner  bool
+		wantErr     bool
+	}{
+		{"", true, true, true, false},
+		{"", false, false, true, false},
+		{ModeDebug, false, true, true, false},
+		{ModeRelease, true, false, false, false},
+		{"prod", false, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			fiberMode = tt.mode
+			fs := NewNamed("test", "mode", 0, nil)
+			fs.noLogger, fs.VerboseErrors = true, tt.verbose
+			fs.ErrorFormat = "app"
+
+			err := fs.Configure()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Configure() err = %v, want err %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if Mode() != tt.mode || fs.verboseErrors() != tt.wantVerbose || fs.fiberConfig().DisableStartupMessage == tt.wantBanner {
+				t.Errorf("mode %q: verbose = %v, startup message disabled = %v", Mode(), fs.verboseErrors(), fs.fiberConfig().DisableStartupMessage)
+			}
+
+			// internals of errors are rendered in verbose mode only
+			fs.AddHandler(func(app *fiber.App) {
+				app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("db password is wrong") })
+			})
+			fs.register(fs.app, fs.routes)
+			if _, body := get(t, fs.app, "/fail"); strings.Contains(body, "password") != tt.wantVerbose {
+				t.Errorf("body = %s, want internals %v", body, tt.wantVerbose)
+			}
+		})
+	}
+}
+
+func TestNoDefault(t *testing.T) {
+	tests := []struct {
+		name          string
+		noDefault     bool
+		wantRequestID bool
+	}{
+		{"defaults", false, true},
+		// panics are recovered without the default middlewares as well
+		{"no default", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newTestServer(t, "")
+			fs.FiberNoDefault = tt.noDefault
+			if err := fs.Configure(); err != nil {
+				t.Fatal(err)
+			}
+			fs.AddHandler(func(app *fiber.App) {
+				app.Get("/panic", func(c *fiber.Ctx) error { panic("boom") })
+			})
+			fs.register(fs.app, fs.routes)
+
+			resp, err := fs.app.Test(httptest.NewRequest(http.MethodGet, "/panic", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusInternalServerError {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+			}
+			if got := resp.Header.Get(fs.RequestIDHeader) != ""; got != tt.wantRequestID {
+				t.Errorf("request ID set = %v, want %v", got, tt.wantRequestID)
+			}
+		})
+	}
+}
@@ -2,14 +2,13 @@ package httpserver
 
 import (
 	"net"
-	"net/http"
+	"sync"
 	"time"
 )
 
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
-// connections. It's used by ListenAndServe and ListenAndServeTLS so
-// dead TCP connections (e.g. closing laptop mid-download) eventually
-// go away.
+// connections. It's used by the fiber server so dead TCP connections
+// (e.g. closing laptop mid-download) eventually go away.
 type tcpKeepAliveListener struct {
 	*net.TCPListener
 }
@@ -24,14 +23,57 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 	return tc, nil
 }
 
-type myHttpServer struct {
-	http.Server
+// connTracker remembers open connections of a listener,
+// so connections which outlive the drain timeout can be closed
+type connTracker struct {
+	net.Listener
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
 }
 
-func (srv *myHttpServer) Serve(lis net.Listener) error {
-	return srv.Server.Serve(tcpKeepAliveListener{lis.(*net.TCPListener)})
+func newConnTracker(lis net.Listener) *connTracker {
+	return &connTracker{Listener: lis, conns: map[*trackedConn]struct{}{}}
 }
 
-func (srv *myHttpServer) ServeTLS(lis net.Listener, certFile, keyFile string) error {
-	return srv.Server.ServeTLS(tcpKeepAliveListener{lis.(*net.TCPListener)}, certFile, keyFile)
+func (t *connTracker) Accept() (net.Conn, error) {
+	c, err := t.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &trackedConn{Conn: c, tracker: t}
+	t.mu.Lock()
+	t.conns[tc] = struct{}{}
+	t.mu.Unlock()
+	return tc, nil
+}
+
+// closeAll closes open connections and returns how many they were
+func (t *connTracker) closeAll() int {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	for _, c := range conns {
+		_ = c.Close()
+	}
+	return len(conns)
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.mu.Lock()
+		delete(c.tracker.conns, c)
+		c.tracker.mu.Unlock()
+	})
+	return c.Conn.Close()
 }
@@ -0,0 +1,102 @@
+// Helpers to walk the fiber route stack
+package routes
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type useKey struct {
+	path    string
+	handler uintptr
+}
+
+// Tracker collects group prefixes and middlewares of an app while routes are registered,
+// it must be installed before the first route.
+//
+// Fiber doesn't tell middlewares apart, the tracker knows them by their registration:
+// Use adds a route to every method stack at once, while All adds a route per method
+// and counts the handlers each time. Middlewares of mounted apps are not known
+type Tracker struct {
+	app *fiber.App
+	// Use adds a route to each method stack
+	methods int
+
+	mu       sync.Mutex
+	prefixes map[string]bool
+	uses     map[useKey]bool
+	// handler count after the last route, the route and how many routes its registration added
+	count uint32
+	last  useKey
+	added int
+}
+
+// Track installs a tracker on the app
+func Track(app *fiber.App) *Tracker {
+	t := &Tracker{app: app, methods: len(app.Stack()), prefixes: map[string]bool{}, uses: map[useKey]bool{}}
+	app.Hooks().OnGroup(func(g fiber.Group) error {
+		t.mu.Lock()
+		t.prefixes[g.Prefix] = true
+		t.mu.Unlock()
+		return nil
+	})
+	app.Hooks().OnRoute(func(r fiber.Route) error {
+		t.onRoute(&r)
+		return nil
+	})
+	return t
+}
+
+func (t *Tracker) onRoute(r *fiber.Route) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := keyOf(r)
+	count := t.app.HandlersCount()
+	if count != t.count || key != t.last {
+		t.count, t.last, t.added = count, key, 0
+	}
+	if t.added++; t.added == t.methods {
+		t.uses[key] = true
+	}
+}
+
+// keyOf identifies a route by its path and first handler. Consecutive
+// middlewares of a path are merged into the route of the first one
+func keyOf(r *fiber.Route) useKey {
+	key := useKey{path: r.Path}
+	if len(r.Handlers) > 0 {
+		key.handler = reflect.ValueOf(r.Handlers[0]).Pointer()
+	}
+	return key
+}
+
+// IsMiddleware reports whether the route is added by Use
+func (t *Tracker) IsMiddleware(r *fiber.Route) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.uses[keyOf(r)]
+}
+
+// GroupOf returns the longest group prefix which contains the path
+func (t *Tracker) GroupOf(path string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	group := ""
+	for p := range t.prefixes {
+		if HasPathPrefix(path, p) && len(p) > len(group) {
+			group = p
+		}
+	}
+	return group
+}
+
+// HasPathPrefix reports whether a middleware of the prefix applies to the path
+func HasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTracker(t *testing.T) {
+	a := func(c *fiber.Ctx) error { return c.Next() }
+	b := func(c *fiber.Ctx) error { return c.Next() }
+	h := func(c *fiber.Ctx) error { return nil }
+
+	app := fiber.New()
+	tracker := Track(app)
+	app.Use(a)
+	// merged into the route of a
+	app.Use(b)
+	app.Get("/users", h)
+	app.All("/proxy", h)
+	app.Static("/assets", ".")
+	api := app.Group("/api", a)
+	api.Use("/admin", b)
+	api.Post("/items", a, h)
+	app.Group("/v2").Put("/items", h)
+
+	uses := map[string]bool{}
+	endpoints := map[string]bool{}
+	for _, r := range app.Stack()[0] {
+		if tracker.IsMiddleware(r) {
+			uses[r.Path] = true
+		} else {
+			endpoints[r.Path] = true
+		}
+	}
+	for _, r := range app.Stack()[2] {
+		if !tracker.IsMiddleware(r) {
+			endpoints[r.Path] = true
+		}
+	}
+
+	tests := []struct {
+		path string
+		use  bool
+	}{
+		{"/", true},
+		{"/api", true},
+		{"/api/admin", true},
+		{"/users", false},
+		{"/proxy", false},
+		{"/assets", false},
+		{"/api/items", false},
+	}
+	for _, tt := range tests {
+		if uses[tt.path] != tt.use || endpoints[tt.path] == tt.use {
+			t.Errorf("route %s is middleware = %v, want %v", tt.path, uses[tt.path], tt.use)
+		}
+	}
+
+	groups := []struct {
+		path string
+		want string
+	}{
+		{"/api/items", "/api"},
+		{"/v2/items", "/v2"},
+		{"/users", ""},
+		{"/apiary", ""},
+	}
+	for _, tt := range groups {
+		if got := tracker.GroupOf(tt.path); got != tt.want {
+			t.Errorf("GroupOf(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix string
+		want   bool
+	}{
+		{"/users", "/", true},
+		{"/users", "", true},
+		{"/api/users", "/api", true},
+		{"/api", "/api/", true},
+		{"/apiary", "/api", false},
+	}
+	for _, tt := range tests {
+		if got := HasPathPrefix(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("HasPathPrefix(%s, %s) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
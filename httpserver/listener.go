@@ -0,0 +1,168 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schemes of bind addresses which are not TCP
+const (
+	UnixScheme = "unix://"
+	FDScheme   = "fd://"
+)
+
+// first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// listen opens the listener of a bind address:
+//
+//	unix:///run/app.sock   unix socket, created with the file mode
+//	fd://3                 inherited file descriptor
+//	fd://http              inherited file descriptor named by LISTEN_FDNAMES
+//	0.0.0.0, [::1], ...    TCP on the port
+func listen(bindAddr string, port int, socketMode os.FileMode) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(bindAddr, UnixScheme):
+		return listenUnix(strings.TrimPrefix(bindAddr, UnixScheme), socketMode)
+	case strings.HasPrefix(bindAddr, FDScheme):
+		return listenFD(strings.TrimPrefix(bindAddr, FDScheme))
+	}
+	return net.Listen("tcp", formatBindAddr(bindAddr, port))
+}
+
+// listenUnix removes a stale socket file left by a crashed process,
+// the file is removed again when the listener is closed
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		_ = lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// inheritedFDs are the descriptors passed by systemd socket activation or a parent
+// process on restarts. They are read once per process and LISTEN_* are unset
+// after, so child processes don't take them
+type inheritedFDs struct {
+	once  sync.Once
+	count int
+	names []string
+	err   error
+
+	mu    sync.Mutex
+	files map[int]*os.File // opened on first use
+}
+
+var inherited = new(inheritedFDs)
+
+func (in *inheritedFDs) load() error {
+	in.once.Do(func() {
+		defer func() {
+			for _, name := range []string{"LISTEN_FDS", "LISTEN_PID", "LISTEN_FDNAMES"} {
+				_ = os.Unsetenv(name)
+			}
+		}()
+
+		count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || count <= 0 {
+			in.err = errors.New("LISTEN_FDS is not set")
+			return
+		}
+		if pid := os.Getenv("LISTEN_PID"); pid != strconv.Itoa(os.Getpid()) {
+			in.err = fmt.Errorf("LISTEN_PID %q is not this process", pid)
+			return
+		}
+
+		in.count = count
+		in.names = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		in.files = map[int]*os.File{}
+	})
+	return in.err
+}
+
+func (in *inheritedFDs) file(fd int) *os.File {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	f, ok := in.files[fd]
+	if !ok {
+		f = os.NewFile(uintptr(fd), "listen-fd-"+strconv.Itoa(fd))
+		in.files[fd] = f
+	}
+	return f
+}
+
+// listenFD uses an inherited listener by number or by name of LISTEN_FDNAMES,
+// a descriptor can be used many times (ex: on reloads)
+func listenFD(name string) (net.Listener, error) {
+	if err := inherited.load(); err != nil {
+		return nil, fmt.Errorf("fd://%s: %v", name, err)
+	}
+
+	fd, err := strconv.Atoi(name)
+	if err != nil {
+		fd = -1
+		for i, n := range inherited.names {
+			if n == name && i < inherited.count {
+				fd = listenFDsStart + i
+				break
+			}
+		}
+		if fd < 0 {
+			return nil, fmt.Errorf("fd://%s: not found in LISTEN_FDNAMES", name)
+		}
+	}
+	if fd < listenFDsStart || fd >= listenFDsStart+inherited.count {
+		return nil, fmt.Errorf("fd://%s: out of LISTEN_FDS %d", name, inherited.count)
+	}
+
+	// FileListener duplicates the descriptor, the inherited one stays open for next uses
+	return net.FileListener(inherited.file(fd))
+}
+
+// dupListener returns a listener of the same socket, it keeps accepting
+// connections when the original listener is closed
+func dupListener(lis net.Listener) (net.Listener, error) {
+	f, ok := lis.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("cannot share listener of %s", lis.Addr())
+	}
+
+	file, err := f.File()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// parseFileMode parses an octal mode, ex: 0660
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q", s)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,260 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	stale := filepath.Join(dir, "stale.sock")
+	lis, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a crashed process leaves its socket file
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = lis.Close()
+
+	inUse := filepath.Join(dir, "in-use.sock")
+	running, err := net.Listen("unix", inUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer running.Close()
+
+	regular := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(regular, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"new", filepath.Join(dir, "new.sock"), ""},
+		{"stale", stale, ""},
+		{"in use", inUse, "in use"},
+		{"not a socket", regular, "not a socket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := listen(UnixScheme+tt.path, 0, 0o600)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("listen() err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fi, err := os.Stat(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0o600 || getPort(lis) != 0 {
+				t.Errorf("mode = %s, port = %d", fi.Mode().Perm(), getPort(lis))
+			}
+			_ = lis.Close()
+			if _, err := os.Stat(tt.path); !os.IsNotExist(err) {
+				t.Errorf("socket file is not removed on close: %v", err)
+			}
+		})
+	}
+}
+
+// passFD returns the descriptor of a new TCP listener, as if it were passed as the
+// last of LISTEN_FDS. The descriptor is owned by inherited and closed by resetInherited
+func passFD(t *testing.T) (net.Listener, int, int) {
+	t.Helper()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tcp, fd, fd - listenFDsStart + 1
+}
+
+// resetInherited makes LISTEN_* be read again, as in a new process
+func resetInherited(t *testing.T) {
+	t.Cleanup(func() {
+		for _, f := range inherited.files {
+			_ = f.Close()
+		}
+		inherited = new(inheritedFDs)
+	})
+}
+
+func setListenEnv(count int, pid, names string) {
+	for name, value := range map[string]string{"LISTEN_FDS": strconv.Itoa(count), "LISTEN_PID": pid, "LISTEN_FDNAMES": names} {
+		os.Setenv(name, value)
+	}
+}
+
+func TestListenFD(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name    string
+		addr    func(fd int) string
+		pid     string
+		byName  bool
+		wantErr string
+	}{
+		{"by number", func(fd int) string { return FDScheme + strconv.Itoa(fd) }, pid, false, ""},
+		{"by name", func(int) string { return FDScheme + "http" }, pid, true, ""},
+		{"other process", func(fd int) string { return FDScheme + strconv.Itoa(fd) }, "1", false, "not this process"},
+		{"no LISTEN_PID", func(fd int) string { return FDScheme + strconv.Itoa(fd) }, "", false, "not this process"},
+		{"unknown name", func(int) string { return FDScheme + "admin" }, pid, true, "not found"},
+		{"out of range", func(fd int) string { return FDScheme + strconv.Itoa(fd+1) }, pid, false, "out of LISTEN_FDS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetInherited(t)
+			tcp, fd, count := passFD(t)
+			defer tcp.Close()
+
+			names := ""
+			if tt.byName {
+				names = strings.Repeat("other:", count-1) + "http"
+			}
+			setListenEnv(count, tt.pid, names)
+
+			lis, err := listen(tt.addr(fd), 0, 0)
+			if tt.wantErr != "" {
+				_ = syscall.Close(fd)
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("listen() err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			if lis.Addr().String() != tcp.Addr().String() {
+				t.Errorf("addr = %s, want %s", lis.Addr(), tcp.Addr())
+			}
+		})
+	}
+
+	resetInherited(t)
+	if _, err := listen(FDScheme+"3", 0, 0); err == nil || !strings.Contains(err.Error(), "LISTEN_FDS is not set") {
+		t.Errorf("listen() without LISTEN_FDS err = %v", err)
+	}
+}
+
+func TestListenFDTwice(t *testing.T) {
+	resetInherited(t)
+	tcp, _, count := passFD(t)
+	defer tcp.Close()
+	setListenEnv(count, strconv.Itoa(os.Getpid()), strings.Repeat("other:", count-1)+"http")
+
+	first, err := listen(FDScheme+"http", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"LISTEN_FDS", "LISTEN_PID", "LISTEN_FDNAMES"} {
+		if v, ok := os.LookupEnv(name); ok {
+			t.Errorf("%s = %q is left for child processes", name, v)
+		}
+	}
+	_ = first.Close()
+
+	// ex: the listener is opened again on reloads
+	second, err := listen(FDScheme+"http", 0, 0)
+	if err != nil {
+		t.Fatalf("second listen() err = %v", err)
+	}
+	defer second.Close()
+	if second.Addr().String() != tcp.Addr().String() {
+		t.Errorf("addr = %s, want %s", second.Addr(), tcp.Addr())
+	}
+}
+
+func TestDupListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup, err := dupListener(lis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dup.Close()
+	_ = lis.Close()
+
+	// the socket keeps accepting connections
+	go func() {
+		if c, err := dup.Accept(); err == nil {
+			_ = c.Close()
+		}
+	}()
+	c, err := net.Dial("tcp", dup.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+}
+
+func TestBindAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		port int
+		want string
+	}{
+		{"", 80, ":80"},
+		{"127.0.0.1", 80, "127.0.0.1:80"},
+		{"::1", 80, "[::1]:80"},
+		{"[::1]", 80, "[::1]:80"},
+	}
+	for _, tt := range tests {
+		if got := formatBindAddr(tt.addr, tt.port); got != tt.want {
+			t.Errorf("formatBindAddr(%q, %d) = %q, want %q", tt.addr, tt.port, got, tt.want)
+		}
+	}
+
+	modes := []struct {
+		s       string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{"0660", 0o660, false},
+		{"600", 0o600, false},
+		{"rw", 0, true},
+		{"0999", 0, true},
+	}
+	for _, tt := range modes {
+		got, err := parseFileMode(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseFileMode(%q) = %s, %v", tt.s, got, err)
+		}
+	}
+}
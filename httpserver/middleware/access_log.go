@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+)
+
+// Fields of access logs
+const (
+	FieldStatus    = "status"
+	FieldLatency   = "latency"
+	FieldIP        = "ip"
+	FieldMethod    = "method"
+	FieldPath      = "path"
+	FieldRoute     = "route"
+	FieldQuery     = "query"
+	FieldBytes     = "bytes"
+	FieldReferer   = "referer"
+	FieldUserAgent = "user_agent"
+	FieldRequestID = "request_id"
+	FieldUserID    = "user_id"
+	FieldHostname  = "hostname"
+	FieldProtocol  = "protocol"
+)
+
+var DefaultAccessLogFields = []string{
+	FieldStatus, FieldLatency, FieldIP, FieldMethod, FieldPath, FieldRoute,
+	FieldBytes, FieldUserAgent, FieldRequestID, FieldUserID,
+}
+
+type AccessLogConfig struct {
+	// Fields to be logged, default is DefaultAccessLogFields
+	Fields []string
+	// Requests to these paths are not logged, ex: health checks
+	SkipPaths []string
+	// Ratio of 1xx-3xx responses to be logged, from 0 to 1.
+	// Errors are always logged. Zero value means 1
+	SampleRate float64
+}
+
+// AccessLog logs every request after it is handled, with its final status,
+// size and latency. It must be installed before RenderErrors, so errors are logged
+// with their rendered status. Panics are logged with the status Recovery renders,
+// then re-panicked.
+// Entries are logged at error level for 5xx, warn for 4xx, otherwise info
+func AccessLog(log logger.Logger, config ...AccessLogConfig) fiber.Handler {
+	var cfg AccessLogConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if len(cfg.Fields) == 0 {
+		cfg.Fields = DefaultAccessLogFields
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+
+	skip := map[string]bool{}
+	for _, p := range cfg.SkipPaths {
+		skip[p] = true
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	logRequest := newAccessLogger(log, cfg, hostname)
+
+	return func(c *fiber.Ctx) error {
+		if skip[c.Path()] {
+			return c.Next()
+		}
+
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				logRequest(c, panicStatus(r), time.Since(start))
+				panic(r)
+			}
+		}()
+
+		err := c.Next()
+		logRequest(c, c.Response().StatusCode(), time.Since(start))
+		return err
+	}
+}
+
+// newAccessLogger returns the function which logs a handled request
+func newAccessLogger(log logger.Logger, cfg AccessLogConfig, hostname string) func(c *fiber.Ctx, status int, latency time.Duration) {
+	return func(c *fiber.Ctx, status int, latency time.Duration) {
+		if status < fiber.StatusBadRequest && cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+			return
+		}
+
+		fields := logger.Fields{}
+		for _, f := range cfg.Fields {
+			switch f {
+			case FieldStatus:
+				fields[f] = status
+			case FieldLatency:
+				fields[f] = latency.String()
+			case FieldIP:
+				fields[f] = c.IP()
+			case FieldMethod:
+				fields[f] = c.Method()
+			case FieldPath:
+				fields[f] = c.Path()
+			case FieldRoute:
+				fields[f] = routeOf(c)
+			case FieldQuery:
+				fields[f] = string(c.Request().URI().QueryString())
+			case FieldBytes:
+				fields[f] = len(c.Response().Body())
+			case FieldReferer:
+				fields[f] = string(c.Request().Header.Referer())
+			case FieldUserAgent:
+				fields[f] = string(c.Request().Header.UserAgent())
+			case FieldRequestID:
+				if id := GetRequestID(c); id != "" {
+					fields[f] = id
+				}
+			case FieldUserID:
+				if id, ok := CurrentUserID(c); ok {
+					fields[f] = id
+				}
+			case FieldHostname:
+				fields[f] = hostname
+			case FieldProtocol:
+				fields[f] = c.Protocol()
+			}
+		}
+
+		entry := log.Withs(fields)
+		msg := c.Method() + " " + c.OriginalURL()
+		if status >= fiber.StatusInternalServerError {
+			entry.Error(msg)
+		} else if status >= fiber.StatusBadRequest {
+			entry.Warn(msg)
+		} else {
+			entry.Info(msg)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields logger.Fields
+}
+
+// recordLogger records entries logged by Info, Warn and Error
+type recordLogger struct {
+	logger.Logger
+	fields  logger.Fields
+	entries *[]logEntry
+}
+
+func newRecordLogger() *recordLogger {
+	logger.InitServLogger(false)
+	return &recordLogger{Logger: logger.GetCurrent().GetLogger("test"), entries: &[]logEntry{}}
+}
+
+func (l *recordLogger) Withs(fields logger.Fields) logger.Logger {
+	merged := logger.Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &recordLogger{Logger: l.Logger, fields: merged, entries: l.entries}
+}
+
+func (l *recordLogger) With(key string, value interface{}) logger.Logger {
+	return l.Withs(logger.Fields{key: value})
+}
+
+func (l *recordLogger) log(level string, args ...interface{}) {
+	msg, _ := args[0].(string)
+	*l.entries = append(*l.entries, logEntry{level, msg, l.fields})
+}
+
+func (l *recordLogger) Info(args ...interface{}) { l.log("info", args...) }
+func (l *recordLogger) Infof(format string, args ...interface{}) {
+	l.log("info", fmt.Sprintf(format, args...))
+}
+func (l *recordLogger) Warn(args ...interface{})  { l.log("warn", args...) }
+func (l *recordLogger) Error(args ...interface{}) { l.log("error", args...) }
+func (l *recordLogger) Errorf(format string, args ...interface{}) {
+	l.log("error", fmt.Sprintf(format, args...))
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantLevel  string
+		wantStatus int
+		wantRoute  string
+	}{
+		{"ok", "/users/5", "info", http.StatusOK, "/users/:id"},
+		{"client error", "/forbidden", "warn", http.StatusForbidden, "/forbidden"},
+		{"server error", "/fail", "error", http.StatusInternalServerError, "/fail"},
+		{"panic", "/panic", "error", http.StatusInternalServerError, "/panic"},
+		{"unmatched", "/random", "warn", http.StatusNotFound, UnmatchedRoute},
+		{"skipped", "/health", "", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newRecordLogger()
+			app := newTestApp(AccessLog(log, AccessLogConfig{
+				Fields:    []string{FieldStatus, FieldRoute},
+				SkipPaths: []string{"/health"},
+			}))
+			app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString(c.Params("id")) })
+			app.Get("/forbidden", func(c *fiber.Ctx) error {
+				return sdkcm.AppError{StatusCode: http.StatusForbidden, Message: "forbidden"}
+			})
+			app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("db is down") })
+			app.Get("/panic", func(c *fiber.Ctx) error { panic("boom") })
+			app.Get("/health", func(c *fiber.Ctx) error { return nil })
+			app.Use(Unmatched())
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries := *log.entries
+			if tt.wantLevel == "" {
+				if len(entries) != 0 {
+					t.Errorf("entries = %v, want none", entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("entries = %v, want 1", entries)
+			}
+			e := entries[0]
+			if e.level != tt.wantLevel || e.fields[FieldStatus] != tt.wantStatus || e.fields[FieldRoute] != tt.wantRoute {
+				t.Errorf("entry = %+v, want %s status=%d route=%s", e, tt.wantLevel, tt.wantStatus, tt.wantRoute)
+			}
+			// the logged status is the rendered one
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("response status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
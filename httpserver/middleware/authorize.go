@@ -3,7 +3,9 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/valyala/fasthttp"
 
@@ -31,65 +33,105 @@ type CurrentUserContext struct {
 	sdkcm.User
 }
 
+// Auth requirements of routes, see AuthOf
+const (
+	AuthRequired = "required"
+	AuthOptional = "optional"
+	AuthRoles    = "roles"
+)
+
+type authorizer struct {
+	cup CurrentUserProvider
+}
+
 func Authorize(cup CurrentUserProvider, isRequired ...bool) fiber.Handler {
-	required := len(isRequired) == 0
+	a := &authorizer{cup: cup}
+	if len(isRequired) == 0 {
+		return markAuth(a.required, AuthRequired)
+	}
+	return markAuth(a.optional, AuthOptional)
+}
+
+func (a *authorizer) required(c *fiber.Ctx) error { return a.authorize(c, true) }
 
-	return func(c *fiber.Ctx) error {
-		token := accessTokenFromRequest(c.Request())
+func (a *authorizer) optional(c *fiber.Ctx) error { return a.authorize(c, false) }
 
-		if token == "" {
-			if required {
-				panic(sdkcm.ErrUnauthorized(nil, sdkcm.ErrAccessTokenInvalid))
-			} else {
-				c.Locals("current_user", util.EncodeUser(guest{}))
-				return c.Next()
-			}
+func (a *authorizer) authorize(c *fiber.Ctx, required bool) error {
+	token := accessTokenFromRequest(c.Request())
 
+	if token == "" {
+		if required {
+			return sdkcm.ErrUnauthorized(nil, sdkcm.ErrAccessTokenInvalid)
+		} else {
+			c.Locals(CurrentUserKey, util.EncodeUser(guest{}))
+			return c.Next()
 		}
 
-		tc := cup.MustGet("oauth").(oauthclient.TrustedClient)
-		tokenInfo, err := tc.Introspect(token)
+	}
 
-		if err != nil {
-			panic(sdkcm.ErrUnauthorized(err, sdkcm.ErrAccessTokenInactivated))
-		}
+	tc := a.cup.MustGet("oauth").(oauthclient.TrustedClient)
+	tokenInfo, err := tc.Introspect(token)
 
-		if !tokenInfo.Active {
-			panic(sdkcm.ErrUnauthorized(sdkcm.ErrAccessTokenInactivated, sdkcm.ErrAccessTokenInactivated))
-		}
+	if err != nil {
+		return sdkcm.ErrUnauthorized(err, sdkcm.ErrAccessTokenInactivated)
+	}
 
-		// Fetch user info from db
-		u, err := cup.GetCurrentUser(c.Context(), tokenInfo.UserId)
+	if !tokenInfo.Active {
+		return sdkcm.ErrUnauthorized(sdkcm.ErrAccessTokenInactivated, sdkcm.ErrAccessTokenInactivated)
+	}
 
-		if err != nil {
-			panic(sdkcm.ErrUnauthorized(err, sdkcm.ErrUserNotFound))
-		}
+	// Fetch user info from db
+	u, err := a.cup.GetCurrentUser(c.Context(), tokenInfo.UserId)
 
-		c.Locals("current_user", sdkcm.CurrentUser(tokenInfo, u))
-		return c.Next()
+	if err != nil {
+		return sdkcm.ErrUnauthorized(err, sdkcm.ErrUserNotFound)
 	}
+
+	c.Locals(CurrentUserKey, sdkcm.CurrentUser(tokenInfo, u))
+	return c.Next()
 }
 
+type roleGuard []fmt.Stringer
+
 func RequireRoles(roles ...fmt.Stringer) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		r := c.Get("current_user")
+	return markAuth(roleGuard(roles).check, AuthRoles)
+}
 
-		if r == "" {
-			panic(sdkcm.ErrUnauthorized(sdkcm.ErrNoPermission, sdkcm.ErrNoPermission))
-		}
-		var requester CurrentUserContext
-		util.DecodeUser(r, &requester)
-		reqRole := sdkcm.ParseSystemRole(requester.GetSystemRole())
-
-		for _, v := range roles {
-			if v.String() == reqRole.String() {
-				return c.Next()
-			}
+func (roles roleGuard) check(c *fiber.Ctx) error {
+	requester, ok := currentRequester(c)
+	if !ok {
+		return sdkcm.ErrUnauthorized(sdkcm.ErrNoPermission, sdkcm.ErrNoPermission)
+	}
+	reqRole := sdkcm.ParseSystemRole(requester.GetSystemRole())
+
+	for _, v := range roles {
+		if v.String() == reqRole.String() {
+			return c.Next()
 		}
+	}
 
-		panic(sdkcm.ErrUnauthorized(nil, sdkcm.ErrNoPermission))
-		return nil
+	return sdkcm.ErrUnauthorized(nil, sdkcm.ErrNoPermission)
+}
+
+// auth requirements of handlers made by Authorize and RequireRoles, by code pointer.
+// Handlers of a kind share the code of their method value
+var authHandlers sync.Map
+
+func markAuth(hdl fiber.Handler, auth string) fiber.Handler {
+	authHandlers.Store(reflect.ValueOf(hdl).Pointer(), auth)
+	return hdl
+}
+
+// AuthOf returns auth requirement of a handler made by Authorize or RequireRoles,
+// it is empty for other handlers
+func AuthOf(hdl fiber.Handler) string {
+	if hdl == nil {
+		return ""
+	}
+	if auth, ok := authHandlers.Load(reflect.ValueOf(hdl).Pointer()); ok {
+		return auth.(string)
 	}
+	return ""
 }
 
 func accessTokenFromRequest(req *fasthttp.Request) string {
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/util"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAuthOf(t *testing.T) {
+	tests := []struct {
+		name string
+		hdl  fiber.Handler
+		want string
+	}{
+		{"required", Authorize(nil), AuthRequired},
+		{"optional", Authorize(nil, false), AuthOptional},
+		{"roles", RequireRoles(sdkcm.SysRoleRoot), AuthRoles},
+		{"other", func(c *fiber.Ctx) error { return c.Next() }, ""},
+		{"nil", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AuthOf(tt.hdl); got != tt.want {
+				t.Errorf("AuthOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type roleUser string
+
+func (r roleUser) GetSystemRole() string { return string(r) }
+
+func TestRequireRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		local  interface{}
+		header string
+		want   int
+	}{
+		{"role", roleUser(sdkcm.SysRoleAdmin.String()), "", fiber.StatusOK},
+		{"other role", roleUser(sdkcm.SysRoleUser.String()), "", fiber.StatusUnauthorized},
+		{"no user", nil, "", fiber.StatusUnauthorized},
+		{"forged header", nil, `{"system_role":"admin"}`, fiber.StatusUnauthorized},
+		{"forged header over user", roleUser(sdkcm.SysRoleUser.String()), `{"system_role":"admin"}`, fiber.StatusUnauthorized},
+		{"guest", util.EncodeUser(guest{}), "", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(func(c *fiber.Ctx) error {
+				if tt.local != nil {
+					c.Locals(CurrentUserKey, tt.local)
+				}
+				return c.Next()
+			}, RequireRoles(sdkcm.SysRoleRoot, sdkcm.SysRoleAdmin))
+			app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("current_user", tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,162 @@
 package middleware
 
 import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-func AllowCORS() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		c.Response().Header.Set("Access-Control-Allow-Origin", "*")
-		c.Response().Header.Set("Access-Control-Allow-Credentials", "true")
-		c.Response().Header.Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, app_name, app_api_key")
-		c.Response().Header.Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+var (
+	DefaultCORSMethods = []string{
+		fiber.MethodGet, fiber.MethodHead, fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete,
+	}
+	DefaultCORSHeaders = []string{
+		"Accept", "Authorization", "Cache-Control", "Content-Type", "Origin", "X-Requested-With", "X-Request-ID",
+	}
+)
+
+type CORSConfig struct {
+	// Allowed origins, each is one of:
+	//  *                          any origin, not allowed with credentials
+	//  https://example.com        exact origin
+	//  https://*.example.com      any subdomain of example.com, on any port
+	//  regex:https://.+\.dev      origins matching the whole expression
+	AllowOrigins []string
+	// Default is DefaultCORSMethods
+	AllowMethods []string
+	// Default is DefaultCORSHeaders, * reflects headers requested by the preflight
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	// Seconds the preflight is cached by browsers, 0 means not sent
+	MaxAge int
+}
 
-		if c.Method() == "OPTIONS" {
-			return c.SendStatus(201)
+type originMatcher func(origin string) bool
+
+func newOriginMatcher(pattern string) (originMatcher, error) {
+	switch {
+	case pattern == "*":
+		return func(string) bool { return true }, nil
+	case strings.HasPrefix(pattern, "regex:"):
+		// anchored, so https://app\.example\.com doesn't match https://app.example.com.evil.io
+		re, err := regexp.Compile("^(?:" + strings.TrimPrefix(pattern, "regex:") + ")$")
+		if err != nil {
+			return nil, err
 		}
+		return re.MatchString, nil
+	case strings.Contains(pattern, "://*."):
+		parts := strings.SplitN(pattern, "://*.", 2)
+		scheme, domain := strings.ToLower(parts[0]), strings.ToLower(parts[1])
+		return func(origin string) bool {
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme != scheme || u.User != nil || u.Path != "" {
+				return false
+			}
+			return strings.HasSuffix(strings.ToLower(u.Hostname()), "."+domain)
+		}, nil
+	}
 
-		return c.Next()
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+	return func(origin string) bool { return strings.ToLower(origin) == pattern }, nil
+}
+
+// CORS handles cross-origin requests and answers preflight requests with 204.
+// Allowed origins are reflected, * is sent when any origin is allowed.
+// Any origin with credentials is an error: any site could act for the users
+func CORS(config CORSConfig) (fiber.Handler, error) {
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = DefaultCORSMethods
+	}
+	if len(config.AllowHeaders) == 0 {
+		config.AllowHeaders = DefaultCORSHeaders
 	}
+
+	anyOrigin := false
+	matchers := make([]originMatcher, 0, len(config.AllowOrigins))
+	for _, o := range config.AllowOrigins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		m, err := newOriginMatcher(o)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	if anyOrigin && config.AllowCredentials {
+		return nil, errors.New("cors: any origin (*) cannot be allowed with credentials, list the allowed origins")
+	}
+
+	allowMethods := strings.Join(config.AllowMethods, ", ")
+	allowHeaders := strings.Join(config.AllowHeaders, ", ")
+	reflectHeaders := allowHeaders == "*"
+	exposeHeaders := strings.Join(config.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(config.MaxAge)
+
+	allowed := func(origin string) bool {
+		for _, m := range matchers {
+			if m(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		preflight := c.Method() == fiber.MethodOptions && c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+
+		c.Vary(fiber.HeaderOrigin)
+		if origin == "" || !allowed(origin) {
+			if preflight {
+				return c.SendStatus(fiber.StatusNoContent)
+			}
+			return c.Next()
+		}
+
+		if anyOrigin {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		} else {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+		}
+		if config.AllowCredentials {
+			c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				c.Set(fiber.HeaderAccessControlExposeHeaders, exposeHeaders)
+			}
+			return c.Next()
+		}
+
+		c.Vary(fiber.HeaderAccessControlRequestMethod, fiber.HeaderAccessControlRequestHeaders)
+		c.Set(fiber.HeaderAccessControlAllowMethods, allowMethods)
+		if reflectHeaders {
+			if h := c.Get(fiber.HeaderAccessControlRequestHeaders); h != "" {
+				c.Set(fiber.HeaderAccessControlAllowHeaders, h)
+			}
+		} else {
+			c.Set(fiber.HeaderAccessControlAllowHeaders, allowHeaders)
+		}
+		if config.MaxAge > 0 {
+			c.Set(fiber.HeaderAccessControlMaxAge, maxAge)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}, nil
+}
+
+// Deprecated: use CORS, or enable -fiber-cors. AllowCORS allows any origin without credentials,
+// use CORS with the allowed origins for cookies
+func AllowCORS() fiber.Handler {
+	hdl, _ := CORS(CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowHeaders: append(DefaultCORSHeaders, "Content-Length", "Accept-Encoding", "X-CSRF-Token", "app_name", "app_api_key"),
+	})
+	return hdl
 }
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/baozhenglab/go-sdk/v2/errreport"
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// bodies longer than this are truncated in dumps
+const dumpBodyLimit = 4096
+
+// DumpRequests logs requests with their headers and body, it is used by debug mode.
+// Credentials in headers and sensitive fields of JSON bodies are masked, long bodies are truncated
+func DumpRequests(logger logger.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		headers := map[string]string{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			headers[string(key)] = string(value)
+		})
+		reported := errreport.FilterHeaders(headers)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s %s\n", c.Method(), c.OriginalURL(), c.Request().Header.Protocol())
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			v, ok := reported[string(key)]
+			if !ok {
+				v = "***"
+			}
+			fmt.Fprintf(&b, "%s: %s\n", key, v)
+		})
+
+		if body := redactBody(c.Body()); len(body) > dumpBodyLimit {
+			fmt.Fprintf(&b, "\n%s... (%d bytes)", body[:dumpBodyLimit], len(c.Body()))
+		} else if len(body) > 0 {
+			fmt.Fprintf(&b, "\n%s", body)
+		}
+
+		log := logger
+		if requestID := GetRequestID(c); requestID != "" {
+			log = logger.With(RequestIDKey, requestID)
+		}
+		log.Infof("request dump:\n%s", b.String())
+		return c.Next()
+	}
+}
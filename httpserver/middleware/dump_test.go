@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDumpRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  map[string]string
+		body    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "credentials are masked",
+			header:  map[string]string{"Authorization": "Bearer secret", "Cookie": "sid=secret", "X-Api-Key": "secret", "X-Trace": "t1"},
+			want:    []string{"POST /users?page=1", "Authorization: ***", "Cookie: ***", "X-Api-Key: ***", "X-Trace: t1"},
+			notWant: []string{"secret"},
+		},
+		{
+			name: "body",
+			body: `{"name":"a"}`,
+			want: []string{"\n{\"name\":\"a\"}"},
+		},
+		{
+			name:    "sensitive fields of the body are masked",
+			body:    `{"name":"a","password":"hunter2"}`,
+			want:    []string{`"name":"a"`, `"password":"***"`},
+			notWant: []string{"hunter2"},
+		},
+		{
+			name:    "body which is not JSON is dumped by its size",
+			body:    "password=hunter2",
+			want:    []string{"<16 bytes>"},
+			notWant: []string{"hunter2"},
+		},
+		{
+			name:    "long body is truncated",
+			body:    `{"name":"` + strings.Repeat("x", dumpBodyLimit) + `tail"}`,
+			want:    []string{"... (4111 bytes)"},
+			notWant: []string{"tail"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newRecordLogger()
+			app := fiber.New()
+			app.Use(RequestID(""), DumpRequests(log))
+			app.Post("/users", func(c *fiber.Ctx) error { return nil })
+
+			req := httptest.NewRequest(http.MethodPost, "/users?page=1", strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*log.entries) != 1 {
+				t.Fatalf("entries = %v, want a dump", *log.entries)
+			}
+			entry := (*log.entries)[0]
+			for _, s := range tt.want {
+				if !strings.Contains(entry.msg, s) {
+					t.Errorf("dump has no %q:\n%s", s, entry.msg)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(entry.msg, s) {
+					t.Errorf("dump has %q:\n%s", s, entry.msg)
+				}
+			}
+			if entry.fields[RequestIDKey] == nil {
+				t.Errorf("dump has no request ID: %v", entry.fields)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/baozhenglab/go-sdk/v2/logger"
@@ -10,37 +12,176 @@ import (
 	"gopkg.in/go-playground/validator.v9"
 )
 
-func ErrorHandler(logger logger.Logger) func(*fiber.Ctx, error) error {
+// Formats of error responses
+const (
+	// AppError with the request ID
+	ErrorFormatApp = "app"
+	// RFC 7807 problem details
+	ErrorFormatProblem = "problem"
+	// problem details when clients accept application/problem+json, AppError otherwise
+	ErrorFormatNegotiate = "negotiate"
+)
+
+// ErrorInfo is an error returned by a handler, resolved to what its response shows
+type ErrorInfo struct {
+	Status int
+	Code   string
+	// a string, or messages per field of validation errors
+	Message interface{}
+	// root cause, empty unless errors are verbose
+	Log       string
+	RequestID string
+	// error returned by the handler
+	Err error
+}
+
+// ErrorRenderer writes the response of an error, it decides the shape of error responses
+type ErrorRenderer func(c *fiber.Ctx, e *ErrorInfo) error
+
+// errorResponse is AppError with ID of the request, so clients can report it
+type errorResponse struct {
+	sdkcm.AppError
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// RenderAppError renders errors as AppError, the default shape
+func RenderAppError(c *fiber.Ctx, e *ErrorInfo) error {
+	appErr := sdkcm.AppError{Code: e.Code, Log: e.Log, StatusCode: e.Status, Message: e.Message}
+	return c.Status(e.Status).JSON(errorResponse{appErr, e.RequestID})
+}
+
+type ErrorHandlerConfig struct {
+	// Include root cause (AppError.Log) in responses, it must be off in prd
+	Verbose bool
+	// Format of responses: app | problem | negotiate. Empty is negotiate
+	Format string
+	// Base URI of problem types, codes of errors are appended, ex: https://errors.example.com/.
+	// Problems without a code, or without this URI, are about:blank
+	ProblemTypeURI string
+	// Renderer of a custom shape, Format is ignored when it is set
+	Renderer ErrorRenderer
+}
+
+// ValidErrorFormat checks a format of error responses
+func ValidErrorFormat(format string) error {
+	switch format {
+	case "", ErrorFormatApp, ErrorFormatProblem, ErrorFormatNegotiate:
+		return nil
+	}
+	return fmt.Errorf("unknown error format %q, must be %s, %s or %s",
+		format, ErrorFormatApp, ErrorFormatProblem, ErrorFormatNegotiate)
+}
+
+// renderer of the config
+func (cfg ErrorHandlerConfig) renderer() ErrorRenderer {
+	if cfg.Renderer != nil {
+		return cfg.Renderer
+	}
+
+	problem := ProblemRenderer(cfg.ProblemTypeURI)
+	switch cfg.Format {
+	case ErrorFormatApp:
+		return RenderAppError
+	case ErrorFormatProblem:
+		return problem
+	}
+	return func(c *fiber.Ctx, e *ErrorInfo) error {
+		if AcceptsProblem(c) {
+			return problem(c, e)
+		}
+		return RenderAppError(c, e)
+	}
+}
+
+// RenderErrors renders errors of the next handlers by the app ErrorHandler, once.
+// Middlewares installed before it (Tracing, Metrics, AccessLog) read the final
+// status from c.Response(), and the error by RenderedError
+func RenderErrors() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if err == nil {
+			return nil
+		}
+
+		c.Locals(RenderedErrorKey, err)
+		if herr := c.App().Config().ErrorHandler(c, err); herr != nil {
+			_ = c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return nil
+	}
+}
+
+// RenderedError returns the error of the request rendered by RenderErrors
+func RenderedError(c *fiber.Ctx) error {
+	err, _ := c.Locals(RenderedErrorKey).(error)
+	return err
+}
+
+// ErrorHandler renders errors returned by handlers as AppError or problem details.
+// Errors which are not AppError or validation errors are mapped by RegisterError
+// and RegisterErrorType, the others are 500. 5xx errors are sent to the error
+// reporter. Without config, root cause of errors is included in responses
+func ErrorHandler(logger logger.Logger, config ...ErrorHandlerConfig) func(*fiber.Ctx, error) error {
+	cfg := ErrorHandlerConfig{Verbose: true}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	render := cfg.renderer()
+
 	return func(c *fiber.Ctx, err error) error {
-		var appErr sdkcm.AppError
-		if appErr, ok := err.(sdkcm.AppError); ok {
-			appErr.RootCause = appErr.RootError()
-			logger.Errorln(appErr.RootCause)
-			if appErr.RootCause != nil {
-				appErr.Log = appErr.RootCause.Error()
+		requestID := GetRequestID(c)
+		log := logger
+		if requestID != "" {
+			log = logger.With(RequestIDKey, requestID)
+		}
+
+		e := &ErrorInfo{RequestID: requestID, Err: err}
+		var (
+			appErr   sdkcm.AppError
+			formErr  validator.ValidationErrors
+			fiberErr *fiber.Error
+		)
+		if errors.As(err, &appErr) {
+			root := appErr.RootError()
+			log.Errorln(root)
+			e.Status, e.Code, e.Message = appErr.StatusCode, appErr.Code, appErr.Message
+			if root != nil {
+				e.Log = root.Error()
 			}
 			//if lvLogger == logrus.TraceLevel.String() {
 			//	panic(err)
 			//}
-			return c.Status(appErr.StatusCode).JSON(appErr)
-		} else if formErr, ok := err.(validator.ValidationErrors); ok {
-			message := sdkcm.GetErrors(formErr)
-			appErr = sdkcm.ErrUnprocessableEntity(message)
-			return c.Status(appErr.StatusCode).JSON(appErr)
-		} else if e, ok := err.(error); ok {
-
-			appErr = sdkcm.AppError{StatusCode: http.StatusInternalServerError, Message: "internal server error"}
-			logger.Errorln(e.Error())
-			return c.Status(appErr.StatusCode).JSON(appErr)
+			if appErr.StatusCode >= http.StatusInternalServerError {
+				reportError(c, err)
+			}
+		} else if errors.As(err, &formErr) {
+			appErr = sdkcm.ErrUnprocessableEntity(sdkcm.GetErrors(formErr))
+			e.Status, e.Code, e.Message, e.Log = appErr.StatusCode, appErr.Code, appErr.Message, appErr.Log
+		} else if m, ok := ResolveError(err); ok {
+			// the whole chain is logged, ex: "get user 5: record not found"
+			e.Status, e.Code, e.Message, e.Log = m.Status, m.Code, m.Message, err.Error()
+			if m.Status >= http.StatusInternalServerError {
+				log.Errorln(err.Error())
+				reportError(c, err)
+			} else {
+				log.Warnln(err.Error())
+			}
+		} else if errors.As(err, &fiberErr) {
+			// ex: 404 of unknown routes, 413 of large bodies
+			e.Status, e.Message, e.Log = fiberErr.Code, fiberErr.Message, err.Error()
+			if fiberErr.Code >= http.StatusInternalServerError {
+				log.Errorln(err.Error())
+				reportError(c, err)
+			}
 		} else {
-			appErr = sdkcm.AppError{StatusCode: http.StatusInternalServerError, Message: "internal server error"}
-			logger.Errorln(err)
-			return c.Status(appErr.StatusCode).JSON(appErr)
+			e.Status, e.Message, e.Log = http.StatusInternalServerError, "internal server error", err.Error()
+			log.Errorln(err.Error())
+			reportError(c, err)
 		}
 
-		//if lvLogger == logrus.TraceLevel.String() {
-		//	panic(err)
-		//}
-		return c.Status(appErr.StatusCode).JSON(appErr)
+		if !cfg.Verbose {
+			e.Log = ""
+		}
+		return render(c, e)
 	}
 }
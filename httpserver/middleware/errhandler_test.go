@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRenderErrorsOnce(t *testing.T) {
+	logger.InitServLogger(false)
+	log := logger.GetCurrent().GetLogger("test")
+	handle := ErrorHandler(log, ErrorHandlerConfig{Format: ErrorFormatApp})
+
+	var rendered int
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		rendered++
+		return handle(c, err)
+	}})
+	app.Use(Recovery(log), Tracing(), Metrics(prometheus.NewRegistry(), "test"), AccessLog(log), RenderErrors())
+
+	var seen error
+	app.Use(func(c *fiber.Ctx) error {
+		err := c.Next()
+		seen = err
+		return err
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("db is down") })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", resp.StatusCode)
+	}
+	if rendered != 1 {
+		t.Errorf("error rendered %d times, want once", rendered)
+	}
+	if seen == nil || seen.Error() != "db is down" {
+		t.Errorf("error of handler = %v", seen)
+	}
+}
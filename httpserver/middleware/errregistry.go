@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// ErrorMapping is how errors of a domain are shown in responses
+type ErrorMapping struct {
+	Status int
+	Code   string
+	// Message of responses. Empty uses the message of the matched error for
+	// 4xx, and "internal server error" for 5xx
+	Message string
+}
+
+// a registered sentinel error or error type
+type errorEntry struct {
+	target  error
+	typ     reflect.Type
+	mapping ErrorMapping
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []errorEntry
+)
+
+// RegisterError maps a sentinel error to a response, errors wrapping it are
+// matched by errors.Is, so handlers can return plain Go errors, ex:
+//
+//	middleware.RegisterError(gorm.ErrRecordNotFound, middleware.ErrorMapping{Status: 404, Code: "not_found"})
+func RegisterError(target error, mapping ErrorMapping) {
+	if target == nil {
+		panic("middleware: RegisterError of nil error")
+	}
+	register(errorEntry{target: target, mapping: mapping})
+}
+
+// RegisterErrorType maps errors of a type to a response, target is a value of
+// the type and errors are matched by errors.As, ex:
+//
+//	middleware.RegisterErrorType((*ConflictError)(nil), middleware.ErrorMapping{Status: 409, Code: "conflict"})
+func RegisterErrorType(target error, mapping ErrorMapping) {
+	if target == nil {
+		panic("middleware: RegisterErrorType of nil interface, use a typed value, ex: (*MyError)(nil)")
+	}
+	register(errorEntry{typ: reflect.TypeOf(target), mapping: mapping})
+}
+
+func register(e errorEntry) {
+	if e.mapping.Status < 400 || e.mapping.Status > 599 {
+		panic(fmt.Sprintf("middleware: status of error mapping must be 4xx or 5xx, got %d", e.mapping.Status))
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, e)
+}
+
+// ResolveError finds the mapping of err, registrations are matched in order.
+// The message of a mapping without one is filled
+func ResolveError(err error) (ErrorMapping, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, e := range registry {
+		var matched error
+		if e.target != nil {
+			if !errors.Is(err, e.target) {
+				continue
+			}
+			matched = e.target
+		} else {
+			ptr := reflect.New(e.typ)
+			if !errors.As(err, ptr.Interface()) {
+				continue
+			}
+			matched = ptr.Elem().Interface().(error)
+		}
+
+		m := e.mapping
+		if m.Message == "" {
+			if m.Status >= http.StatusInternalServerError {
+				m.Message = "internal server error"
+			} else {
+				m.Message = matched.Error()
+			}
+		}
+		return m, true
+	}
+	return ErrorMapping{}, false
+}
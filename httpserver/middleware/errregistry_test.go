@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errNotFound = errors.New("record not found")
+	errNoQuota  = errors.New("quota store is down")
+	errMissing  = errors.New("missing")
+)
+
+type conflictError struct{ name string }
+
+func (e *conflictError) Error() string { return e.name + " already exists" }
+
+func init() {
+	RegisterError(errNotFound, ErrorMapping{Status: http.StatusNotFound, Code: "not_found"})
+	RegisterError(errNoQuota, ErrorMapping{Status: http.StatusServiceUnavailable, Code: "no_quota"})
+	RegisterError(errMissing, ErrorMapping{Status: http.StatusGone, Code: "missing", Message: "it is gone"})
+	RegisterErrorType((*conflictError)(nil), ErrorMapping{Status: http.StatusConflict, Code: "conflict"})
+}
+
+func TestResolveError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorMapping
+		ok   bool
+	}{
+		{"sentinel", errNotFound, ErrorMapping{http.StatusNotFound, "not_found", "record not found"}, true},
+		{"wrapped", fmt.Errorf("get user 5: %w", errNotFound), ErrorMapping{http.StatusNotFound, "not_found", "record not found"}, true},
+		{"5xx message is hidden", fmt.Errorf("check quota: %w", errNoQuota), ErrorMapping{http.StatusServiceUnavailable, "no_quota", "internal server error"}, true},
+		{"message of mapping", errMissing, ErrorMapping{http.StatusGone, "missing", "it is gone"}, true},
+		{"type", fmt.Errorf("create: %w", &conflictError{"alice"}), ErrorMapping{http.StatusConflict, "conflict", "alice already exists"}, true},
+		{"unknown", errors.New("record not found"), ErrorMapping{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ResolveError(tt.err)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ResolveError(%v) = %+v, %v, want %+v, %v", tt.err, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRegisterErrorPanics(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func()
+	}{
+		{"nil error", func() { RegisterError(nil, ErrorMapping{Status: http.StatusNotFound}) }},
+		{"nil type", func() { RegisterErrorType(nil, ErrorMapping{Status: http.StatusNotFound}) }},
+		{"2xx status", func() { RegisterError(errors.New("ok"), ErrorMapping{Status: http.StatusOK}) }},
+		{"no status", func() { RegisterErrorType(&conflictError{}, ErrorMapping{}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("registration succeeded, want a panic")
+				}
+			}()
+			tt.register()
+		})
+	}
+}
+
+func TestErrorHandlerRegistry(t *testing.T) {
+	logger.InitServLogger(false)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(logger.GetCurrent().GetLogger("test"), ErrorHandlerConfig{Format: ErrorFormatApp, Verbose: true})})
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		return fmt.Errorf("get user %s: %w", c.Params("id"), errNotFound)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/users/5", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	var body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Log     string `json:"log"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	// the whole chain is the root cause
+	if body.Code != "not_found" || body.Message != "record not found" || body.Log != "get user 5: record not found" {
+		t.Errorf("body = %+v", body)
+	}
+}
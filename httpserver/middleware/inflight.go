@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// InFlight counts requests being handled, so a server can wait for them before it stops
+type InFlight struct {
+	mu    sync.Mutex
+	count int64
+	// closed when the count drops to zero
+	idle     chan struct{}
+	draining int32
+}
+
+func NewInFlight() *InFlight {
+	return &InFlight{}
+}
+
+// Handler counts the request until it is handled. While draining, responses
+// close their connections so keep-alive clients reconnect to other instances
+func (f *InFlight) Handler(c *fiber.Ctx) error {
+	f.add()
+	defer f.done()
+
+	if f.Draining() {
+		c.Context().SetConnectionClose()
+	}
+	return c.Next()
+}
+
+func (f *InFlight) add() {
+	f.mu.Lock()
+	if f.count == 0 {
+		f.idle = make(chan struct{})
+	}
+	f.count++
+	f.mu.Unlock()
+}
+
+func (f *InFlight) done() {
+	f.mu.Lock()
+	if f.count--; f.count == 0 {
+		close(f.idle)
+	}
+	f.mu.Unlock()
+}
+
+// Count returns the number of requests being handled
+func (f *InFlight) Count() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count
+}
+
+// Drain marks the server as draining, it is not ready for new requests
+func (f *InFlight) Drain() {
+	atomic.StoreInt32(&f.draining, 1)
+}
+
+func (f *InFlight) Draining() bool {
+	return atomic.LoadInt32(&f.draining) == 1
+}
+
+// Wait waits until no request is in flight or the timeout is exceeded,
+// it returns the number of requests still in flight
+func (f *InFlight) Wait(timeout time.Duration) int64 {
+	f.mu.Lock()
+	if f.count == 0 {
+		f.mu.Unlock()
+		return 0
+	}
+	idle := f.idle
+	f.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+	case <-timer.C:
+	}
+	return f.Count()
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestInFlightWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests int
+		// requests are released after it, never when it is 0
+		release time.Duration
+		timeout time.Duration
+		want    int64
+	}{
+		{"idle", 0, 0, time.Second, 0},
+		{"handled in time", 2, 20 * time.Millisecond, 5 * time.Second, 0},
+		{"timeout", 1, 0, 20 * time.Millisecond, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewInFlight()
+			started, release := make(chan struct{}), make(chan struct{})
+			app := fiber.New()
+			app.Use(f.Handler)
+			app.Get("/", func(c *fiber.Ctx) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+
+			done := make(chan struct{})
+			for i := 0; i < tt.requests; i++ {
+				go func() {
+					_, _ = app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+					done <- struct{}{}
+				}()
+				<-started
+			}
+			if got := f.Count(); got != int64(tt.requests) {
+				t.Fatalf("Count() = %d, want %d", got, tt.requests)
+			}
+			if tt.release > 0 {
+				time.AfterFunc(tt.release, func() { close(release) })
+			}
+
+			start := time.Now()
+			if got := f.Wait(tt.timeout); got != tt.want {
+				t.Errorf("Wait() = %d, want %d", got, tt.want)
+			}
+			// Wait returns when requests are handled, not at the timeout
+			if tt.want == 0 && time.Since(start) > tt.timeout/2 {
+				t.Errorf("Wait() took %s", time.Since(start))
+			}
+
+			if tt.release == 0 {
+				close(release)
+			}
+			for i := 0; i < tt.requests; i++ {
+				<-done
+			}
+			if got := f.Wait(time.Second); got != 0 {
+				t.Errorf("Wait() after requests = %d", got)
+			}
+		})
+	}
+}
+
+func TestInFlightDrain(t *testing.T) {
+	f := NewInFlight()
+	app := fiber.New()
+	app.Use(f.Handler)
+	app.Get("/", func(c *fiber.Ctx) error { return nil })
+
+	for _, draining := range []bool{false, true} {
+		if draining {
+			f.Drain()
+		}
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Draining() != draining || resp.Close != draining {
+			t.Errorf("draining = %v, connection close = %v", f.Draining(), resp.Close)
+		}
+	}
+}
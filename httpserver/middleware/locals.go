@@ -0,0 +1,60 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+// Keys of c.Locals shared by middlewares
+const (
+	RequestIDKey     = "request_id"
+	CurrentUserKey   = "current_user"
+	RenderedErrorKey = "rendered_error"
+	UnmatchedKey     = "unmatched"
+)
+
+// Route of requests which no route matches, their paths are never used as labels
+const UnmatchedRoute = "unmatched"
+
+// Unmatched marks requests which no route matches, it must be added after all
+// routes. The request goes on to fiber, which answers 404 (or 405 for other
+// methods of the path)
+func Unmatched() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(UnmatchedKey, true)
+		return c.Next()
+	}
+}
+
+// IsUnmatched reports whether no route matches the request, see Unmatched
+func IsUnmatched(c *fiber.Ctx) bool {
+	unmatched, _ := c.Locals(UnmatchedKey).(bool)
+	return unmatched
+}
+
+// routeOf returns the template of the matched route (ex: /users/:id), or UnmatchedRoute
+func routeOf(c *fiber.Ctx) string {
+	if IsUnmatched(c) {
+		return UnmatchedRoute
+	}
+	return c.Route().Path
+}
+
+// CurrentUserID returns ID of the user set by Authorize, guests have no ID
+func CurrentUserID(c *fiber.Ctx) (uint32, bool) {
+	u, ok := c.Locals(CurrentUserKey).(interface{ UserID() uint32 })
+	if !ok || u.UserID() == 0 {
+		return 0, false
+	}
+	return u.UserID(), true
+}
+
+// currentRequester returns the user set by Authorize, the request header of the same name is
+// never read since clients can forge it
+func currentRequester(c *fiber.Ctx) (interface{ GetSystemRole() string }, bool) {
+	switch u := c.Locals(CurrentUserKey).(type) {
+	case interface{ GetSystemRole() string }:
+		return u, true
+	case string:
+		// optional Authorize stores guests encoded
+		return guest{}, true
+	}
+	return nil, false
+}
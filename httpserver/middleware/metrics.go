@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RED metrics of a http server, labelled by the server name
+type httpMetrics struct {
+	requests *prometheus.CounterVec
+	inFlight prometheus.Gauge
+	duration *prometheus.HistogramVec
+}
+
+func newHTTPMetrics(reg prometheus.Registerer, server string) *httpMetrics {
+	constLabels := prometheus.Labels{"server": server}
+	labels := []string{"method", "route", "status_class"}
+
+	m := &httpMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "http_requests_total",
+			Help:        "Number of handled http requests.",
+			ConstLabels: constLabels,
+		}, labels),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "http_requests_in_flight",
+			Help:        "Number of http requests being handled.",
+			ConstLabels: constLabels,
+		}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "http_request_duration_seconds",
+			Help:        "Latency of http requests.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.DefBuckets,
+		}, labels),
+	}
+
+	m.requests = registerOrExisting(reg, m.requests).(*prometheus.CounterVec)
+	m.inFlight = registerOrExisting(reg, m.inFlight).(prometheus.Gauge)
+	m.duration = registerOrExisting(reg, m.duration).(*prometheus.HistogramVec)
+	return m
+}
+
+// registerOrExisting returns the registered collector if it is registered
+// before, ex: the app is configured again on reload
+func registerOrExisting(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+// Metrics collects request count, in-flight requests and latency,
+// labelled by method, route template (ex: /users/:id) and status class (ex: 2xx).
+// Requests which no route matches are labelled by UnmatchedRoute, so scans of
+// random paths don't create series. Requests to skipPaths (ex: the metrics
+// endpoint) are not counted. It must be installed before RenderErrors, so the
+// rendered status is counted. Panics are counted with the status Recovery
+// renders, then re-panicked
+func Metrics(reg prometheus.Registerer, server string, skipPaths ...string) fiber.Handler {
+	m := newHTTPMetrics(reg, server)
+	skip := map[string]bool{}
+	for _, p := range skipPaths {
+		skip[p] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		if skip[c.Path()] {
+			return c.Next()
+		}
+
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		observe := func(code int) {
+			status := strconv.Itoa(code/100) + "xx"
+			method := c.Method()
+			route := routeOf(c)
+
+			m.requests.WithLabelValues(method, route, status).Inc()
+			m.duration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				observe(panicStatus(r))
+				panic(r)
+			}
+		}()
+
+		err := c.Next()
+		observe(c.Response().StatusCode())
+		return err
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestCounts returns http_requests_total by "method route status_class"
+func requestCounts(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			counts[labels["method"]+" "+labels["route"]+" "+labels["status_class"]] = m.GetCounter().GetValue()
+		}
+	}
+	return counts
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   string
+	}{
+		{"route template", http.MethodGet, "/users/5", "GET /users/:id 2xx"},
+		{"rendered error", http.MethodGet, "/fail", "GET /fail 5xx"},
+		{"panic", http.MethodGet, "/panic", "GET /panic 5xx"},
+		{"unmatched path", http.MethodGet, "/random/scan", "GET unmatched 4xx"},
+		{"unmatched method", http.MethodDelete, "/users/5", "DELETE unmatched 4xx"},
+		{"skipped", http.MethodGet, "/metrics", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			app := newTestApp(Metrics(reg, "test", "/metrics"))
+			app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString(c.Params("id")) })
+			app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("db is down") })
+			app.Get("/panic", func(c *fiber.Ctx) error { panic("boom") })
+			app.Get("/metrics", func(c *fiber.Ctx) error { return nil })
+			app.Use(Unmatched())
+
+			if _, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil)); err != nil {
+				t.Fatal(err)
+			}
+
+			counts := requestCounts(t, reg)
+			if tt.want == "" {
+				if len(counts) != 0 {
+					t.Errorf("counts = %v, want none", counts)
+				}
+				return
+			}
+			if len(counts) != 1 || counts[tt.want] != 1 {
+				t.Errorf("counts = %v, want %q once", counts, tt.want)
+			}
+		})
+	}
+}
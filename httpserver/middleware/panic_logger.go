@@ -2,14 +2,18 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"os"
-	"runtime"
+	"regexp"
 	"time"
 
+	"github.com/baozhenglab/go-sdk/v2/errreport"
+	sdklogger "github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/sdkcm"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -20,30 +24,137 @@ var (
 	slash     = []byte("/")
 )
 
+// PanicLogger recovers panics and logs them by the SDK logger, see Recovery
 func PanicLogger() fiber.Handler {
-	return RecoveryWithWriter(os.Stderr)
+	return Recovery(sdklogger.GetCurrent().GetLogger("recovery"))
 }
 
-// RecoveryWithWriter returns a middleware for a given writer that recovers from any panics and writes a 500 if there was one.
-func RecoveryWithWriter(out io.Writer) fiber.Handler {
+type RecoveryConfig struct {
+	// Log only the panic value, without the request body and stack trace. It is set by release mode
+	NoStack bool
+}
+
+// Recovery recovers panics of handlers, so they are rendered by ErrorHandler:
+// a panic with an AppError responds with its status, ex: panic(sdkcm.ErrUnauthorized(...)),
+// other panics are 500 and logged with the request ID, the redacted body and the stack
+func Recovery(logger sdklogger.Logger, config ...RecoveryConfig) fiber.Handler {
+	var cfg RecoveryConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if appErr, ok := panicAppError(r); ok {
+				err = appErr
+				return
+			}
+			pe := &PanicError{Value: r, Stack: errreport.Stack(2)}
+			err = pe
+
+			log := logger.Withs(sdklogger.Fields{"method": c.Method(), "path": c.Path()})
+			if requestID := GetRequestID(c); requestID != "" {
+				log = log.With(RequestIDKey, requestID)
+			}
+			if cfg.NoStack {
+				log.Errorf("panic recovered: %v", r)
+				return
+			}
+			log.With("body", redactBody(c.Body())).Errorf("panic recovered: %v\n%s", r, stack(pe.Stack))
+		}()
+		return c.Next()
+	}
+}
+
+// panicAppError returns the AppError a handler panicked with
+func panicAppError(r interface{}) (sdkcm.AppError, bool) {
+	switch v := r.(type) {
+	case sdkcm.AppError:
+		return v, true
+	case *sdkcm.AppError:
+		if v != nil {
+			return *v, true
+		}
+	case error:
+		var appErr sdkcm.AppError
+		if errors.As(v, &appErr) {
+			return appErr, true
+		}
+	}
+	return sdkcm.AppError{}, false
+}
+
+// panicStatus is the status of the response Recovery renders for a panic
+func panicStatus(r interface{}) int {
+	if appErr, ok := panicAppError(r); ok && appErr.StatusCode != 0 {
+		return appErr.StatusCode
+	}
+	return fiber.StatusInternalServerError
+}
+
+// fields of JSON bodies which are never logged
+var sensitiveBodyFields = regexp.MustCompile(`(?i)pass|secret|token|key|auth|card|cvv|otp|pin`)
+
+// redactBody masks sensitive fields of a JSON object body,
+// other bodies are logged by their size only
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	for k := range fields {
+		if sensitiveBodyFields.MatchString(k) {
+			fields[k] = "***"
+		}
+	}
+	redacted, _ := json.Marshal(fields)
+	return string(redacted)
+}
+
+// Deprecated: use Recovery, which logs by the SDK logger.
+// RecoveryWithWriter writes panics to out, they are rendered like Recovery does
+func RecoveryWithWriter(out io.Writer, config ...RecoveryConfig) fiber.Handler {
+	var cfg RecoveryConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
 	var logger *log.Logger
 	if out != nil {
 		logger = log.New(out, "\n\n\x1b[31m", log.LstdFlags)
 	}
-	return func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) (err error) {
 		defer func() {
-			if err := recover(); err != nil {
-				if logger != nil {
-					stack := stack(5)
-					logger.Printf(
-						"[Recovery] %s panic recovered:\n%s\n%s\n%s%s",
-						timeFormat(time.Now()), string(c.Request().Body()),
-						err,
-						stack,
-						string([]byte{27, 91, 48, 109}),
-					)
-				}
-				//c.AbortWithStatus(http.StatusInternalServerError)
+			r := recover()
+			if r == nil {
+				return
+			}
+			if appErr, ok := panicAppError(r); ok {
+				err = appErr
+				return
+			}
+			pe := &PanicError{Value: r, Stack: errreport.Stack(2)}
+			err = pe
+
+			if logger != nil && cfg.NoStack {
+				logger.Printf("[Recovery] %s panic recovered: %s%s",
+					timeFormat(time.Now()), r, string([]byte{27, 91, 48, 109}))
+			} else if logger != nil {
+				logger.Printf(
+					"[Recovery] %s panic recovered:\n%s\n%s\n%s%s",
+					timeFormat(time.Now()), redactBody(c.Request().Body()),
+					r,
+					stack(pe.Stack),
+					string([]byte{27, 91, 48, 109}),
+				)
 			}
 		}()
 		return c.Next()
@@ -55,40 +166,35 @@ func timeFormat(t time.Time) string {
 	return timeString
 }
 
-// stack returns a nicely formatted stack frame, skipping skip frames.
-func stack(skip int) []byte {
+// stack formats frames of a panic with their source lines
+func stack(frames []errreport.Frame) []byte {
 	buf := new(bytes.Buffer) // the returned data
 	// As we loop, we open files and read them. These variables record the currently
 	// loaded file.
 	var lines [][]byte
 	var lastFile string
-	for i := skip; ; i++ { // Skip the expected number of frames
-		pc, file, line, ok := runtime.Caller(i)
-		if !ok {
-			break
-		}
+	for _, f := range frames {
 		// Print this much at least.  If we can't find the source, it won't show.
-		fmt.Fprintf(buf, "%s:%d (0x%x)\n", file, line, pc)
-		if file != lastFile {
-			data, err := ioutil.ReadFile(file)
+		fmt.Fprintf(buf, "%s:%d\n", f.File, f.Line)
+		if f.File != lastFile {
+			data, err := ioutil.ReadFile(f.File)
 			if err != nil {
 				continue
 			}
 			lines = bytes.Split(data, []byte{'\n'})
-			lastFile = file
+			lastFile = f.File
 		}
-		fmt.Fprintf(buf, "\t%s: %s\n", function(pc), source(lines, line))
+		fmt.Fprintf(buf, "\t%s: %s\n", function(f.Function), source(lines, f.Line))
 	}
 	return buf.Bytes()
 }
 
-// function returns, if possible, the name of the function containing the PC.
-func function(pc uintptr) []byte {
-	fn := runtime.FuncForPC(pc)
-	if fn == nil {
+// function returns the name of the function without its package path.
+func function(fn string) []byte {
+	if fn == "" {
 		return dunno
 	}
-	name := []byte(fn.Name())
+	name := []byte(fn)
 	// The name includes the path name to the package, which is unnecessary
 	// since the file name is already included.  Plus, it has center dots.
 	// That is, we see
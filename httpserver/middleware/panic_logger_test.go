@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+)
+
+func panicHandler(c *fiber.Ctx) error {
+	switch c.Query("value") {
+	case "app":
+		panic(sdkcm.ErrInvalidRequest(errors.New("bad id")))
+	default:
+		panic("boom")
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		noStack    bool
+		wantStatus int
+		wantLogged bool
+		wantStack  bool
+	}{
+		{"panic", "", false, http.StatusInternalServerError, true, true},
+		{"no stack", "", true, http.StatusInternalServerError, true, false},
+		{"app error", "app", false, http.StatusBadRequest, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newRecordLogger()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(logger.GetCurrent().GetLogger("test"), ErrorHandlerConfig{Format: ErrorFormatApp})})
+			app.Use(Recovery(log, RecoveryConfig{NoStack: tt.noStack}))
+			app.Post("/panic", panicHandler)
+
+			req := httptest.NewRequest(http.MethodPost, "/panic?value="+tt.value, strings.NewReader(`{"name":"a","password":"b"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			entries := *log.entries
+			if !tt.wantLogged {
+				if len(entries) != 0 {
+					t.Errorf("logged %v, want nothing", entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(entries))
+			}
+			msg := entries[0].msg
+			// the stack is logged once, from where the handler panicked
+			frames := strings.Count(msg, "panicHandler")
+			if tt.wantStack && frames != 1 {
+				t.Errorf("stack has %d frames of the handler, want 1:\n%s", frames, msg)
+			}
+			if !tt.wantStack && frames != 0 {
+				t.Errorf("logged a stack, want none:\n%s", msg)
+			}
+			if body, _ := entries[0].fields["body"].(string); tt.wantStack && strings.Contains(body, `"b"`) {
+				t.Errorf("body %s is not redacted", body)
+			}
+		})
+	}
+}
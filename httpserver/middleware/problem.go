@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// Problem is a problem details object of RFC 7807, fields after Instance are extension members
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// code of AppError
+	Code string `json:"code,omitempty"`
+	// messages per field of validation errors
+	Errors    interface{} `json:"errors,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	// root cause, only in verbose mode
+	Log string `json:"log,omitempty"`
+}
+
+// NewProblem builds problem details of an error, typeURI is the base URI of problem types
+func NewProblem(c *fiber.Ctx, e *ErrorInfo, typeURI string) *Problem {
+	p := &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Instance:  c.OriginalURL(),
+		Code:      e.Code,
+		RequestID: e.RequestID,
+		Log:       e.Log,
+	}
+	if typeURI != "" && e.Code != "" {
+		p.Type = typeURI + e.Code
+	}
+
+	switch m := e.Message.(type) {
+	case nil:
+	case string:
+		p.Detail = m
+	case error:
+		p.Detail = m.Error()
+	default:
+		// ex: messages per field of validation errors
+		p.Detail = "request has invalid fields"
+		p.Errors = m
+	}
+	return p
+}
+
+// ProblemRenderer renders errors as problem details, typeURI is the base URI of problem types
+func ProblemRenderer(typeURI string) ErrorRenderer {
+	return func(c *fiber.Ctx, e *ErrorInfo) error {
+		if err := c.Status(e.Status).JSON(NewProblem(c, e, typeURI)); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, ProblemContentType)
+		return nil
+	}
+}
+
+// AcceptsProblem reports whether the client prefers problem details to other JSON
+func AcceptsProblem(c *fiber.Ctx) bool {
+	if !strings.Contains(c.Get(fiber.HeaderAccept), ProblemContentType) {
+		return false
+	}
+	return c.Accepts(ProblemContentType, fiber.MIMEApplicationJSON) == ProblemContentType
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newErrorApp(cfg ErrorHandlerConfig) *fiber.App {
+	logger.InitServLogger(false)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(logger.GetCurrent().GetLogger("test"), cfg)})
+	app.Use(RequestID(""), RenderErrors())
+	app.Get("/invalid", func(c *fiber.Ctx) error {
+		return sdkcm.ErrInvalidRequest(errors.New("id is not a number"))
+	})
+	app.Get("/fields", func(c *fiber.Ctx) error {
+		return sdkcm.ErrUnprocessableEntity(map[string]string{"name": "required"})
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("db is down") })
+	return app
+}
+
+func TestErrorFormats(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             ErrorHandlerConfig
+		path            string
+		accept          string
+		wantContentType string
+		wantStatus      int
+		// fields of the response body
+		want map[string]interface{}
+		// fields which must not be in the body
+		wantNo []string
+	}{
+		{
+			name: "app", cfg: ErrorHandlerConfig{Format: ErrorFormatApp}, path: "/invalid", accept: ProblemContentType,
+			wantContentType: fiber.MIMEApplicationJSON, wantStatus: http.StatusBadRequest,
+			// root cause is empty unless errors are verbose
+			want:   map[string]interface{}{"status_code": float64(400), "code": "invalid_request", "log": ""},
+			wantNo: []string{"title"},
+		},
+		{
+			name: "problem", cfg: ErrorHandlerConfig{Format: ErrorFormatProblem, ProblemTypeURI: "https://errors.example.com/"}, path: "/invalid",
+			wantContentType: ProblemContentType, wantStatus: http.StatusBadRequest,
+			want: map[string]interface{}{
+				"type": "https://errors.example.com/invalid_request", "title": "Bad Request", "status": float64(400),
+				"instance": "/invalid", "code": "invalid_request",
+			},
+			wantNo: []string{"log", "status_code"},
+		},
+		{
+			name: "problem without type URI", cfg: ErrorHandlerConfig{Format: ErrorFormatProblem}, path: "/invalid",
+			wantContentType: ProblemContentType, wantStatus: http.StatusBadRequest,
+			want: map[string]interface{}{"type": "about:blank"},
+		},
+		{
+			name: "problem of fields", cfg: ErrorHandlerConfig{Format: ErrorFormatProblem}, path: "/fields",
+			wantContentType: ProblemContentType, wantStatus: http.StatusUnprocessableEntity,
+			want: map[string]interface{}{
+				"detail": "request has invalid fields", "errors": map[string]interface{}{"name": "required"},
+			},
+		},
+		{
+			name: "verbose problem", cfg: ErrorHandlerConfig{Format: ErrorFormatProblem, Verbose: true}, path: "/fail",
+			wantContentType: ProblemContentType, wantStatus: http.StatusInternalServerError,
+			want: map[string]interface{}{"detail": "internal server error", "log": "db is down"},
+		},
+		{
+			name: "negotiated problem", cfg: ErrorHandlerConfig{}, path: "/invalid", accept: ProblemContentType + ", application/json;q=0.5",
+			wantContentType: ProblemContentType, wantStatus: http.StatusBadRequest,
+			want: map[string]interface{}{"title": "Bad Request"},
+		},
+		{
+			name: "negotiated json", cfg: ErrorHandlerConfig{}, path: "/invalid", accept: "application/json, " + ProblemContentType + ";q=0.5",
+			wantContentType: fiber.MIMEApplicationJSON, wantStatus: http.StatusBadRequest,
+			want: map[string]interface{}{"status_code": float64(400)},
+		},
+		{
+			name: "negotiated without accept", cfg: ErrorHandlerConfig{}, path: "/invalid", accept: "*/*",
+			wantContentType: fiber.MIMEApplicationJSON, wantStatus: http.StatusBadRequest,
+			want: map[string]interface{}{"status_code": float64(400)},
+		},
+		{
+			name: "custom renderer", cfg: ErrorHandlerConfig{Format: ErrorFormatProblem, Renderer: func(c *fiber.Ctx, e *ErrorInfo) error {
+				return c.Status(e.Status).JSON(fiber.Map{"error": e.Code})
+			}}, path: "/invalid",
+			wantContentType: fiber.MIMEApplicationJSON, wantStatus: http.StatusBadRequest,
+			want: map[string]interface{}{"error": "invalid_request"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set(fiber.HeaderAccept, tt.accept)
+			}
+			resp, err := newErrorApp(tt.cfg).Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, tt.wantContentType) {
+				t.Errorf("content type = %s, want %s", ct, tt.wantContentType)
+			}
+			var body map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.want {
+				if got, _ := json.Marshal(body[k]); string(got) != mustJSON(v) {
+					t.Errorf("%s = %s, want %s", k, got, mustJSON(v))
+				}
+			}
+			for _, k := range tt.wantNo {
+				if _, ok := body[k]; ok {
+					t.Errorf("body has %s = %v, want none", k, body[k])
+				}
+			}
+			if tt.cfg.Renderer == nil && body["request_id"] == nil {
+				t.Errorf("body %v has no request ID", body)
+			}
+		})
+	}
+}
+
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestValidErrorFormat(t *testing.T) {
+	for _, format := range []string{"", ErrorFormatApp, ErrorFormatProblem, ErrorFormatNegotiate} {
+		if err := ValidErrorFormat(format); err != nil {
+			t.Errorf("ValidErrorFormat(%q) = %v, want nil", format, err)
+		}
+	}
+	if err := ValidErrorFormat("xml"); err == nil {
+		t.Error("ValidErrorFormat(xml) = nil, want an error")
+	}
+}
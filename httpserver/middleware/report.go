@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/baozhenglab/go-sdk/v2/errreport"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PanicError is the error of a recovered panic, Stack is where it panicked
+type PanicError struct {
+	Value interface{}
+	Stack []errreport.Frame
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Breadcrumbs collects breadcrumbs of requests for error reports,
+// add them by errreport.AddBreadcrumb(c.UserContext(), ...)
+func Breadcrumbs() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := errreport.WithBreadcrumbs(c.UserContext())
+		errreport.AddBreadcrumb(ctx, errreport.Breadcrumb{
+			Category: "http",
+			Message:  c.Method() + " " + c.Path(),
+			Level:    errreport.LevelInfo,
+		})
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// reportError captures an error of a 5xx response with the request and current user
+func reportError(c *fiber.Ctx, err error) {
+	if !errreport.IsEnabled() {
+		return
+	}
+
+	headers := map[string]string{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		headers[string(key)] = string(value)
+	})
+	r := &errreport.Report{
+		Request: &errreport.Request{
+			Method:    c.Method(),
+			URL:       c.BaseURL() + c.Path(),
+			Query:     string(c.Request().URI().QueryString()),
+			Headers:   errreport.FilterHeaders(headers),
+			IP:        c.IP(),
+			RequestID: GetRequestID(c),
+		},
+	}
+	if id, ok := CurrentUserID(c); ok {
+		r.UserID = strconv.FormatUint(uint64(id), 10)
+	}
+
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		r.Stack = pe.Stack
+		r.Tags = map[string]string{"mechanism": "panic"}
+	} else {
+		// returned errors have no stack, it starts at the error handler
+		r.Stack = errreport.Stack(1)
+	}
+	errreport.Capture(c.UserContext(), err, r)
+}
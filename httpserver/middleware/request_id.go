@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/go-sdk/v2/util/requestid"
+)
+
+// RequestID accepts the request ID from the header (default X-Request-ID)
+// or generates a new one. The ID is stored in c.Locals(RequestIDKey) and
+// c.UserContext(), and echoed in the response. All logs written while handling
+// the request have it, goroutines started by handlers log it by
+// log.WithContext(c.UserContext()). Outbound calls of util/httpclient forward
+// it in the same header
+func RequestID(header ...string) fiber.Handler {
+	name := requestid.Header
+	if len(header) > 0 && header[0] != "" {
+		name = header[0]
+	}
+
+	return func(c *fiber.Ctx) error {
+		id := c.Get(name)
+		if !requestid.IsValid(id) {
+			id = requestid.New()
+		}
+
+		ctx := requestid.NewContextWithHeader(c.UserContext(), id, name)
+		c.Locals(RequestIDKey, id)
+		c.SetUserContext(logger.NewContext(ctx, logger.Fields{RequestIDKey: id}))
+		c.Set(name, id)
+
+		unbind := logger.BindFields(logger.Fields{RequestIDKey: id})
+		defer unbind()
+
+		return c.Next()
+	}
+}
+
+// GetRequestID returns ID of the current request, empty if RequestID is not used
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(RequestIDKey).(string)
+	return id
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/go-sdk/v2/util/requestid"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		sent     string
+		wantSent bool
+	}{
+		{"generated", "", "", false},
+		{"from client", "", "abc-123", true},
+		{"invalid from client", "", "bad id\n" + strings.Repeat("x", 200), false},
+		{"custom header", "X-Correlation-ID", "abc-123", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.header
+			if name == "" {
+				name = requestid.Header
+			}
+
+			var local, fromCtx, ctxHeader string
+			var fields logger.Fields
+			app := fiber.New()
+			app.Use(RequestID(tt.header))
+			app.Get("/", func(c *fiber.Ctx) error {
+				local = GetRequestID(c)
+				fromCtx = requestid.FromContext(c.UserContext())
+				ctxHeader = requestid.HeaderFromContext(c.UserContext())
+				fields = logger.FieldsFromContext(c.UserContext())
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sent != "" {
+				req.Header.Set(name, tt.sent)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			echoed := resp.Header.Get(name)
+			if !requestid.IsValid(echoed) || (tt.wantSent && echoed != tt.sent) || (!tt.wantSent && echoed == tt.sent) {
+				t.Errorf("echoed id = %q, sent %q", echoed, tt.sent)
+			}
+			if local != echoed || fromCtx != echoed || fields[RequestIDKey] != echoed {
+				t.Errorf("ids differ: locals=%q context=%q log fields=%v echoed=%q", local, fromCtx, fields, echoed)
+			}
+			if ctxHeader != name {
+				t.Errorf("header of context = %q, want %q", ctxHeader, name)
+			}
+		})
+	}
+}
+
+// syncBuffer is written by the server goroutine and read by the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRequestIDLogs(t *testing.T) {
+	logger.InitServLogger(false)
+	out, ok := logger.GetCurrent().(interface{ SetOutput(io.Writer) })
+	if !ok {
+		t.Fatal("the service logger cannot be captured")
+	}
+	buf := &syncBuffer{}
+	out.SetOutput(buf)
+	defer out.SetOutput(os.Stderr)
+
+	done := make(chan struct{})
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/", func(c *fiber.Ctx) error {
+		// the ordinary service logger, ex: sc.Logger("users")
+		logger.GetCurrent().GetLogger("users").Info("in handler")
+		// fiber reuses c after the handler returns
+		ctx := c.UserContext()
+		go func() {
+			defer close(done)
+			logger.GetCurrent().GetLogger("users").WithContext(ctx).Info("in goroutine")
+		}()
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestid.Header, "abc-123")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	logger.GetCurrent().GetLogger("users").Info("after request")
+
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"in handler", true},
+		{"in goroutine", true},
+		{"after request", false},
+	}
+	lines := strings.Split(buf.String(), "\n")
+	for _, tt := range tests {
+		var line string
+		for _, l := range lines {
+			if strings.Contains(l, tt.msg) {
+				line = l
+			}
+		}
+		if line == "" {
+			t.Errorf("%q is not logged", tt.msg)
+			continue
+		}
+		if got := strings.Contains(line, RequestIDKey+"=abc-123"); got != tt.want {
+			t.Errorf("log %q has the request ID = %v, want %v", line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/baozhenglab/go-sdk/v2/httpserver"
+
+// headerCarrier adapts fasthttp headers to propagation.TextMapCarrier
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (hc headerCarrier) Get(key string) string {
+	return string(hc.header.Peek(key))
+}
+
+func (hc headerCarrier) Set(key, value string) {
+	hc.header.Set(key, value)
+}
+
+func (hc headerCarrier) Keys() []string {
+	keys := make([]string, 0)
+	hc.header.VisitAll(func(k, _ []byte) {
+		keys = append(keys, string(k))
+	})
+	return keys
+}
+
+// recordError adds the exception event of err like span.RecordError does,
+// but it never calls Error of sdkcm.AppError, see exceptionMessage
+func recordError(span trace.Span, err error) {
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+		semconv.ExceptionType(fmt.Sprintf("%T", err)),
+		semconv.ExceptionMessage(exceptionMessage(err)),
+	))
+}
+
+// exceptionMessage describes err with its root cause. Error of sdkcm.AppError
+// panics when its message is not a string (ex: messages per field)
+func exceptionMessage(err error) string {
+	var appErr sdkcm.AppError
+	if !errors.As(err, &appErr) {
+		return err.Error()
+	}
+
+	msg := fmt.Sprint(appErr.Message)
+	if root := appErr.RootError(); root != nil {
+		msg += ": " + exceptionMessage(root)
+	}
+	return msg
+}
+
+// Tracing starts a server span per request, parent is extracted from
+// W3C traceparent/B3 headers. Span is named by the route template,
+// ex: "GET /users/:id". Span context is put in c.UserContext().
+// It must be installed before RenderErrors, so the span has the rendered status.
+// Panics are recorded and re-panicked, they are recovered by Recovery
+func Tracing() fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		tracer := otel.Tracer(tracerName)
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{&c.Request().Header})
+
+		ctx, span := tracer.Start(ctx, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(c.Path()),
+				semconv.URLScheme(c.Protocol()),
+				semconv.ClientAddress(c.IP()),
+				semconv.UserAgentOriginal(string(c.Request().Header.UserAgent())),
+			),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		defer func() {
+			if r := recover(); r != nil {
+				span.SetStatus(codes.Error, fmt.Sprint(r))
+				span.SetAttributes(semconv.HTTPResponseStatusCode(panicStatus(r)))
+				panic(r)
+			}
+		}()
+
+		err = c.Next()
+		if rendered := RenderedError(c); rendered != nil {
+			recordError(span, rendered)
+		} else if err != nil {
+			recordError(span, err)
+		}
+
+		// spans of unmatched requests are named by the method only
+		if !IsUnmatched(c) {
+			route := c.Route().Path
+			span.SetName(c.Method() + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		status := c.Response().StatusCode()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// newTestApp returns an app installing middlewares like the server does:
+// Recovery is outermost, errors are rendered by RenderErrors after middlewares
+func newTestApp(middlewares ...fiber.Handler) *fiber.App {
+	logger.InitServLogger(false)
+	log := logger.GetCurrent().GetLogger("test")
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(log, ErrorHandlerConfig{Format: ErrorFormatApp})})
+	app.Use(Recovery(log, RecoveryConfig{NoStack: true}))
+	for _, m := range middlewares {
+		app.Use(m)
+	}
+	app.Use(RenderErrors())
+	return app
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	app := newTestApp(Tracing())
+	app.Get("/ok", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	// Error of AppError panics when its message is not a string
+	app.Get("/invalid", func(c *fiber.Ctx) error {
+		return sdkcm.AppError{StatusCode: http.StatusBadRequest, Code: "invalid",
+			Message: map[string][]string{"name": {"required"}}, RootCause: errors.New("bad name")}
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("db is down") })
+	app.Get("/panic", func(c *fiber.Ctx) error { panic("boom") })
+
+	tests := []struct {
+		path        string
+		wantStatus  int
+		wantRoute   string
+		wantError   bool
+		wantMessage string
+	}{
+		{"/ok", http.StatusOK, "/ok", false, ""},
+		{"/invalid", http.StatusBadRequest, "/invalid", false, "map[name:[required]]: bad name"},
+		{"/fail", http.StatusInternalServerError, "/fail", true, "db is down"},
+		// span.End records the panic
+		{"/panic", http.StatusInternalServerError, "", true, "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			before := len(recorder.Ended())
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != before+1 {
+				t.Fatalf("spans = %d, want 1", len(spans)-before)
+			}
+			span := spans[before]
+			if got := spanAttribute(span, semconv.HTTPResponseStatusCodeKey).AsInt64(); got != int64(tt.wantStatus) {
+				t.Errorf("span status = %d, want %d", got, tt.wantStatus)
+			}
+			if tt.wantRoute != "" && span.Name() != "GET "+tt.wantRoute {
+				t.Errorf("span name = %q, want GET %s", span.Name(), tt.wantRoute)
+			}
+			if got := span.Status().Code == codes.Error; got != tt.wantError {
+				t.Errorf("span error = %v, want %v", got, tt.wantError)
+			}
+
+			var message string
+			for _, e := range span.Events() {
+				if e.Name != semconv.ExceptionEventName {
+					continue
+				}
+				for _, kv := range e.Attributes {
+					if kv.Key == semconv.ExceptionMessageKey {
+						message = kv.Value.AsString()
+					}
+				}
+			}
+			if message != tt.wantMessage {
+				t.Errorf("exception message = %q, want %q", message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestRecoveryOutermost(t *testing.T) {
+	// a panic of a middleware is recovered when Recovery is installed first
+	app := newTestApp(func(c *fiber.Ctx) error {
+		panic(sdkcm.AppError{StatusCode: http.StatusUnauthorized, Message: "no token"})
+	})
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
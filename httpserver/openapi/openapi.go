@@ -0,0 +1,263 @@
+// OpenAPI 3 documents of fiber routes
+//
+// Routes are annotated by putting Doc first in their handlers:
+//
+//	v1.Post("/users", openapi.Doc(openapi.Operation{
+//		Summary:  "Create a user",
+//		Tags:     []string{"users"},
+//		Request:  CreateUserForm{},
+//		Response: User{},
+//	}), createUser)
+//
+// Generate reads annotations from the route stack, routes without Doc are
+// documented by their path and method only.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver/internal/routes"
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const Version = "3.0.3"
+
+// Operation annotates a route
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Body of requests, a struct or a pointer to struct
+	Request interface{}
+	// Query parameters, fields are named by `query` tags
+	Query interface{}
+	// Body of responses with ResponseStatus, default is 200
+	Response       interface{}
+	ResponseStatus int
+	Deprecated     bool
+}
+
+// Doc annotates a route with the operation, it must be the first handler of the route
+func Doc(op Operation) fiber.Handler {
+	return (&docMarker{op: op}).handle
+}
+
+// docMarker is found by name of its method value, names of closures
+// change when they are inlined
+type docMarker struct {
+	op Operation
+}
+
+func (d *docMarker) handle(c *fiber.Ctx) error {
+	if sink, ok := c.Locals(sinkKey).(*Operation); ok {
+		*sink = d.op
+		return nil
+	}
+	return c.Next()
+}
+
+const sinkKey = "openapi.operation"
+
+// Doc handlers share the code of their method value
+var docHandler = reflect.ValueOf((*docMarker)(nil).handle).Pointer()
+
+// operationOf reads the annotation of a route by running its Doc handler,
+// other handlers are never run
+func operationOf(app *fiber.App, r *fiber.Route) (Operation, bool) {
+	if len(r.Handlers) == 0 || reflect.ValueOf(r.Handlers[0]).Pointer() != docHandler {
+		return Operation{}, false
+	}
+
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(c)
+
+	var op Operation
+	c.Locals(sinkKey, &op)
+	_ = r.Handlers[0](c)
+	return op, true
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Document struct {
+	OpenAPI    string                                   `json:"openapi"`
+	Info       Info                                     `json:"info"`
+	Paths      map[string]map[string]*DocumentOperation `json:"paths"`
+	Components Components                               `json:"components"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// DocumentOperation is an operation of the document, it is made of the route and its Operation annotation
+type DocumentOperation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+const (
+	bearerAuth     = "bearerAuth"
+	appErrorSchema = "AppError"
+	mimeJSON       = fiber.MIMEApplicationJSON
+)
+
+var paramPattern = regexp.MustCompile(`:([A-Za-z0-9_-]+)\??|[*+]`)
+
+// Generate documents routes of the stack. Middleware routes, known by isMiddleware,
+// HEAD routes and built-in debug routes are left out
+func Generate(app *fiber.App, isMiddleware func(r *fiber.Route) bool, info Info, skipPaths ...string) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]map[string]*DocumentOperation{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+	}
+	gen := &schemaGenerator{schemas: doc.Components.Schemas}
+	gen.ref(reflect.TypeOf(sdkcm.AppError{}), appErrorSchema)
+
+	skip := map[string]bool{}
+	for _, p := range skipPaths {
+		skip[p] = true
+	}
+
+	for _, stack := range app.Stack() {
+		var uses []*fiber.Route
+		for _, r := range stack {
+			if isMiddleware(r) {
+				uses = append(uses, r)
+				continue
+			}
+			if r.Method == fiber.MethodHead || r.Method == fiber.MethodConnect || skip[r.Path] ||
+				strings.HasPrefix(r.Path, "/debug/") {
+				continue
+			}
+
+			path, params := openAPIPath(r.Path)
+			op := &DocumentOperation{OperationID: r.Name, Responses: map[string]*Response{}}
+			for _, p := range params {
+				op.Parameters = append(op.Parameters, &Parameter{Name: p, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+			}
+
+			if ann, ok := operationOf(app, r); ok {
+				op.Summary, op.Description, op.Tags, op.Deprecated = ann.Summary, ann.Description, ann.Tags, ann.Deprecated
+				op.Parameters = append(op.Parameters, gen.queryParams(ann.Query)...)
+				if ann.Request != nil {
+					op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+						mimeJSON: {Schema: gen.schemaOf(reflect.TypeOf(ann.Request))},
+					}}
+				}
+
+				status := ann.ResponseStatus
+				if status == 0 {
+					status = http.StatusOK
+				}
+				res := &Response{Description: http.StatusText(status)}
+				if ann.Response != nil {
+					res.Content = map[string]*MediaType{mimeJSON: {Schema: gen.schemaOf(reflect.TypeOf(ann.Response))}}
+				}
+				op.Responses[strconv.Itoa(status)] = res
+			} else {
+				op.Responses[strconv.Itoa(http.StatusOK)] = &Response{Description: http.StatusText(http.StatusOK)}
+			}
+
+			op.Responses["default"] = &Response{
+				Description: "Error",
+				Content:     map[string]*MediaType{mimeJSON: {Schema: &Schema{Ref: schemaRef(appErrorSchema)}}},
+			}
+
+			if authOf(uses, r) {
+				op.Security = []map[string][]string{{bearerAuth: {}}}
+				doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+					bearerAuth: {Type: "http", Scheme: "bearer"},
+				}
+			}
+
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = map[string]*DocumentOperation{}
+			}
+			doc.Paths[path][strings.ToLower(r.Method)] = op
+		}
+	}
+	return doc
+}
+
+// openAPIPath converts /users/:id to /users/{id}, wildcards are named wildcard1, wildcard2...
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	n := 0
+	res := paramPattern.ReplaceAllStringFunc(path, func(m string) string {
+		name := strings.TrimSuffix(strings.TrimPrefix(m, ":"), "?")
+		if m == "*" || m == "+" {
+			n++
+			name = "wildcard" + strconv.Itoa(n)
+		}
+		params = append(params, name)
+		return "{" + name + "}"
+	})
+	return res, params
+}
+
+// authOf reports whether the route requires an access token, optional auth is not a requirement
+func authOf(uses []*fiber.Route, r *fiber.Route) bool {
+	handlers := append([]fiber.Handler{}, r.Handlers...)
+	for _, u := range uses {
+		if routes.HasPathPrefix(r.Path, u.Path) {
+			handlers = append(handlers, u.Handlers...)
+		}
+	}
+	for _, hdl := range handlers {
+		if a := middleware.AuthOf(hdl); a == middleware.AuthRequired || a == middleware.AuthRoles {
+			return true
+		}
+	}
+	return false
+}
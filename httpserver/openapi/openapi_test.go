@@ -0,0 +1,64 @@
+package openapi
+
+import (
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver/internal/routes"
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func TestGenerate(t *testing.T) {
+	h := func(c *fiber.Ctx) error { return nil }
+
+	app := fiber.New()
+	tracker := routes.Track(app)
+	app.Use(func(c *fiber.Ctx) error { return c.Next() })
+	app.Get("/debug/vars", h)
+	app.Get("/health", h)
+	v1 := app.Group("/v1", middleware.Authorize(nil))
+	v1.Post("/items", Doc(Operation{Summary: "Create an item", Request: item{}, Response: item{}, ResponseStatus: 201}), h)
+	v1.Get("/items/:id", h)
+	app.Get("/public/:id?", middleware.Authorize(nil, false), h)
+
+	doc := Generate(app, tracker.IsMiddleware, Info{Title: "test", Version: "1.0.0"}, "/health")
+
+	tests := []struct {
+		path     string
+		method   string
+		status   string
+		params   int
+		security bool
+	}{
+		{"/v1/items", "post", "201", 0, true},
+		{"/v1/items/{id}", "get", "200", 1, true},
+		{"/public/{id}", "get", "200", 1, false},
+	}
+	for _, tt := range tests {
+		op := doc.Paths[tt.path][tt.method]
+		if op == nil {
+			t.Errorf("%s %s is not documented", tt.method, tt.path)
+			continue
+		}
+		if op.Responses[tt.status] == nil || len(op.Parameters) != tt.params || (op.Security != nil) != tt.security {
+			t.Errorf("%s %s = %+v, want status %s, %d params and security %v", tt.method, tt.path, op, tt.status, tt.params, tt.security)
+		}
+	}
+	if op := doc.Paths["/v1/items"]["post"]; op != nil && (op.Summary != "Create an item" || op.RequestBody == nil) {
+		t.Errorf("annotation is not applied: %+v", op)
+	}
+
+	// middlewares, skipped paths, debug routes and HEAD routes are left out
+	for _, path := range []string{"/", "/v1", "/health", "/debug/vars"} {
+		if _, ok := doc.Paths[path]; ok {
+			t.Errorf("%s is documented", path)
+		}
+	}
+	if _, ok := doc.Paths["/v1/items/{id}"]["head"]; ok {
+		t.Error("HEAD route is documented")
+	}
+}
@@ -0,0 +1,73 @@
+package openapi
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// SwaggerUIVersion is the version of swagger-ui-dist loaded by default
+const SwaggerUIVersion = "5.17.14"
+
+// DefaultSwaggerUIAssets is the base URL of swagger-ui-dist, pinned to SwaggerUIVersion
+const DefaultSwaggerUIAssets = "https://unpkg.com/swagger-ui-dist@" + SwaggerUIVersion
+
+var swaggerUITemplate = template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="{{.Assets}}/swagger-ui.css"{{with .CSSIntegrity}} integrity="{{.}}" crossorigin="anonymous"{{end}}>
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{.Assets}}/swagger-ui-bundle.js"{{with .JSIntegrity}} integrity="{{.}}" crossorigin="anonymous"{{end}}></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "{{.SpecURL}}", dom_id: "#swagger-ui", deepLinking: true});
+  </script>
+</body>
+</html>
+`))
+
+// SwaggerUI is a page which renders the document at SpecURL
+type SwaggerUI struct {
+	Title   string
+	SpecURL string
+	// Base URL of swagger-ui-dist scripts and styles, it can be a mirror or
+	// files served by the app. Default is DefaultSwaggerUIAssets
+	Assets string
+	// Subresource integrity of swagger-ui.css and swagger-ui-bundle.js, ex: sha384-...
+	// Browsers refuse assets which don't match them
+	CSSIntegrity string
+	JSIntegrity  string
+}
+
+// WriteSwaggerUI writes the page
+func WriteSwaggerUI(w io.Writer, ui SwaggerUI) error {
+	if ui.Assets == "" {
+		ui.Assets = DefaultSwaggerUIAssets
+	}
+	ui.Assets = strings.TrimSuffix(ui.Assets, "/")
+	return swaggerUITemplate.Execute(w, ui)
+}
+
+// ParseIntegrity parses subresource integrity of swagger-ui.css and
+// swagger-ui-bundle.js, separated by comma
+func ParseIntegrity(s string) (css, js string, err error) {
+	if s == "" {
+		return "", "", nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("want integrity of swagger-ui.css and swagger-ui-bundle.js, got %q", s)
+	}
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "sha256-") && !strings.HasPrefix(p, "sha384-") && !strings.HasPrefix(p, "sha512-") {
+			return "", "", fmt.Errorf("invalid integrity %q, want sha256-, sha384- or sha512- and a base64 digest", p)
+		}
+		parts[i] = p
+	}
+	return parts[0], parts[1], nil
+}
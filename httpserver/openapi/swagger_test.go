@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteSwaggerUI(t *testing.T) {
+	tests := []struct {
+		name    string
+		ui      SwaggerUI
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "pinned default",
+			ui:      SwaggerUI{Title: "api", SpecURL: "/openapi.json"},
+			want:    []string{`href="https://unpkg.com/swagger-ui-dist@` + SwaggerUIVersion + `/swagger-ui.css"`, `url: "\/openapi.json"`},
+			notWant: []string{"integrity"},
+		},
+		{
+			name: "integrity",
+			ui:   SwaggerUI{Title: "api", SpecURL: "/openapi.json", CSSIntegrity: "sha384-css", JSIntegrity: "sha384-js"},
+			want: []string{`swagger-ui.css" integrity="sha384-css" crossorigin="anonymous"`,
+				`swagger-ui-bundle.js" integrity="sha384-js" crossorigin="anonymous"`},
+		},
+		{
+			name: "local assets",
+			ui:   SwaggerUI{Title: "<api>", SpecURL: "/openapi.json", Assets: "/docs/assets/"},
+			want: []string{`src="/docs/assets/swagger-ui-bundle.js"`, "<title>&lt;api&gt;</title>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteSwaggerUI(&buf, tt.ui); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("page has no %s:\n%s", s, buf.String())
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("page has %s:\n%s", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestParseIntegrity(t *testing.T) {
+	tests := []struct {
+		s       string
+		css, js string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{"sha384-a, sha512-b", "sha384-a", "sha512-b", false},
+		{"sha384-a", "", "", true},
+		{"md5-a,sha384-b", "", "", true},
+	}
+	for _, tt := range tests {
+		css, js, err := ParseIntegrity(tt.s)
+		if (err != nil) != tt.wantErr || css != tt.css || js != tt.js {
+			t.Errorf("ParseIntegrity(%q) = %q, %q, %v", tt.s, css, js, err)
+		}
+	}
+}
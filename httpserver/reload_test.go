@@ -0,0 +1,211 @@
+package httpserver
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// failingListener fails to accept connections
+type failingListener struct{ net.Listener }
+
+func (failingListener) Accept() (net.Conn, error) { return nil, errors.New("accept failed") }
+
+func TestServeErrors(t *testing.T) {
+	fs := newTestServer(t, "serve")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	errs := make(chan error, 1)
+	fs.serve(fiber.New(fiber.Config{DisableStartupMessage: true}), failingListener{lis}, errs)
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "accept failed") {
+			t.Errorf("serve() err = %v", err)
+		}
+	default:
+		t.Error("error of the app is dropped")
+	}
+}
+
+// runTestServer runs a server on a random port of localhost, it is stopped by the returned func
+func runTestServer(t *testing.T, fs *fiberService) (<-chan error, func()) {
+	t.Helper()
+	logger.InitServLogger(false)
+	fs.noLogger = true
+	set := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	fs.bindFlags(set, &fs.Config)
+	fs.BindAddr, fs.DrainTimeout = "127.0.0.1", time.Second
+	fs.AddHandler(func(app *fiber.App) {
+		app.Get("/ping", func(c *fiber.Ctx) error { return c.SendString("pong") })
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- fs.Run() }()
+	waitFor(t, func() bool { return fs.Port() != 0 && ping(fs.URI()) == nil })
+	return done, func() { <-fs.Stop() }
+}
+
+// client opens a connection per request, idle connections of drained apps are closed
+var client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+func ping(addr string) error {
+	resp, err := client.Get("http://" + addr + "/ping")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "pong" {
+		return errors.New("unexpected body " + string(body))
+	}
+	return nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition is not met in time")
+}
+
+func TestReload(t *testing.T) {
+	fs := NewNamed("test", "reload", 0, nil)
+	done, stop := runTestServer(t, fs)
+
+	tests := []struct {
+		name     string
+		change   func(cfg *Config)
+		wantErr  bool
+		samePort bool
+	}{
+		{"same address", func(cfg *Config) { cfg.AccessLogSkipPaths = "/ping" }, false, true},
+		{"new port", func(cfg *Config) { cfg.Port = 0 }, false, false},
+		{"invalid TLS keeps the running app", func(cfg *Config) { cfg.TLS.CertFile = "missing.pem" }, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldAddr := fs.URI()
+			cfg := fs.GetConfig()
+			tt.change(&cfg)
+
+			if err := fs.Reload(cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("Reload() err = %v, want err %v", err, tt.wantErr)
+			}
+			if got := fs.URI() == oldAddr; got != tt.samePort {
+				t.Errorf("address %s after reload, was %s", fs.URI(), oldAddr)
+			}
+			if err := ping(fs.URI()); err != nil {
+				t.Errorf("reloaded server: %v", err)
+			}
+			if !tt.samePort {
+				// the previous app is drained
+				waitFor(t, func() bool { return ping(oldAddr) != nil })
+			}
+		})
+	}
+
+	stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() doesn't return after Stop")
+	}
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	var reloads int
+	var reloadErr error
+	fs := NewNamed("test", "admin-reload", 0, nil)
+	fs.SetReloader(func() error {
+		reloads++
+		return reloadErr
+	})
+	done, stop := runTestServer(t, fs)
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	// the path is disabled by default
+	post := func() int {
+		resp, err := client.Post("http://"+fs.URI()+"/reload", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post(); status != http.StatusNotFound || reloads != 0 {
+		t.Fatalf("status = %d and %d reloads, want 404 without reload path", status, reloads)
+	}
+
+	cfg := fs.GetConfig()
+	cfg.ReloadPath = "/reload"
+	if err := fs.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, http.StatusNoContent},
+		{errors.New("invalid env file"), http.StatusInternalServerError},
+	}
+	for i, tt := range tests {
+		reloadErr = tt.err
+		if status := post(); status != tt.want || reloads != i+1 {
+			t.Errorf("status = %d and %d reloads, want %d", status, reloads, tt.want)
+		}
+	}
+}
+
+func TestReloadWhileStarting(t *testing.T) {
+	logger.InitServLogger(false)
+	fs := NewNamed("test", "reload-start", 0, nil)
+	fs.noLogger = true
+	set := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	fs.bindFlags(set, &fs.Config)
+	fs.BindAddr, fs.DrainTimeout = "127.0.0.1", time.Second
+	fs.AddHandler(func(app *fiber.App) {
+		app.Get("/ping", func(c *fiber.Ctx) error { return c.SendString("pong") })
+	})
+
+	// reloads race with Run, run with -race
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for i := 0; i < 20; i++ {
+			cfg := fs.GetConfig()
+			cfg.AccessLogSkipPaths = "/ping"
+			_ = fs.Reload(cfg)
+		}
+	}()
+	done := make(chan error, 1)
+	go func() { done <- fs.Run() }()
+	<-reloaded
+
+	waitFor(t, func() bool { return fs.Port() != 0 && ping(fs.URI()) == nil })
+	<-fs.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("Run() err = %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package httpserver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver/internal/routes"
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/go-sdk/v2/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Formats of route tables
+const (
+	RouteFormatTable = "table"
+	RouteFormatJSON  = "json"
+	RouteFormatCSV   = "csv"
+)
+
+// RouteInfo describes a route with the middlewares it passes through
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+	// Longest group prefix of the path
+	Group       string   `json:"group,omitempty"`
+	Middlewares []string `json:"middlewares"`
+	Handlers    []string `json:"handlers"`
+	// required | optional | roles, empty if the route is public
+	Auth string `json:"auth,omitempty"`
+}
+
+// appRoutes tracks groups and middlewares of an app from its creation
+type appRoutes struct {
+	*routes.Tracker
+
+	mu sync.Mutex
+	// set once the routes of handlers are added
+	registered bool
+}
+
+func trackRoutes(app *fiber.App) *appRoutes {
+	return &appRoutes{Tracker: routes.Track(app)}
+}
+
+func (ar *appRoutes) setRegistered() {
+	ar.mu.Lock()
+	ar.registered = true
+	ar.mu.Unlock()
+}
+
+func (ar *appRoutes) isRegistered() bool {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.registered
+}
+
+// describeRoutes lists routes of the stack, sorted by path and method.
+// HEAD routes added along with GET routes are skipped
+func describeRoutes(stack [][]*fiber.Route, tracked *appRoutes) []RouteInfo {
+	infos := make([]RouteInfo, 0)
+	gets := map[string]bool{}
+
+	for _, methodStack := range stack {
+		var uses []*fiber.Route
+		for _, r := range methodStack {
+			if tracked.IsMiddleware(r) {
+				uses = append(uses, r)
+				continue
+			}
+
+			if r.Method == fiber.MethodGet {
+				gets[r.Path] = true
+			}
+
+			info := RouteInfo{
+				Method:      r.Method,
+				Path:        r.Path,
+				Name:        r.Name,
+				Group:       tracked.GroupOf(r.Path),
+				Middlewares: []string{},
+				Handlers:    []string{},
+			}
+			for _, u := range uses {
+				if !routes.HasPathPrefix(r.Path, u.Path) {
+					continue
+				}
+				for _, hdl := range u.Handlers {
+					info.Middlewares = append(info.Middlewares, util.GetFunctionName(hdl))
+					info.Auth = strongerAuth(info.Auth, middleware.AuthOf(hdl))
+				}
+			}
+			for _, hdl := range r.Handlers {
+				info.Handlers = append(info.Handlers, util.GetFunctionName(hdl))
+				info.Auth = strongerAuth(info.Auth, middleware.AuthOf(hdl))
+			}
+			infos = append(infos, info)
+		}
+	}
+
+	res := infos[:0]
+	for _, r := range infos {
+		if r.Method != fiber.MethodHead || !gets[r.Path] {
+			res = append(res, r)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
+}
+
+var authRank = map[string]int{"": 0, middleware.AuthOptional: 1, middleware.AuthRequired: 2, middleware.AuthRoles: 3}
+
+func strongerAuth(a, b string) string {
+	if authRank[b] > authRank[a] {
+		return b
+	}
+	return a
+}
+
+// WriteRoutes writes routes as an ASCII table, JSON or CSV
+func WriteRoutes(w io.Writer, routes []RouteInfo, format string) error {
+	switch format {
+	case "", RouteFormatTable:
+		table := tablewriter.NewWriter(w)
+		table.SetRowLine(true)
+		table.SetHeader([]string{"Path", "Method", "Name", "Group", "Auth", "Middlewares", "Handlers"})
+		for _, r := range routes {
+			table.Append([]string{r.Path, r.Method, r.Name, r.Group, r.Auth,
+				strings.Join(r.Middlewares, "\n"), strings.Join(r.Handlers, "\n")})
+		}
+		table.Render()
+		return nil
+	case RouteFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(routes)
+	case RouteFormatCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"path", "method", "name", "group", "auth", "middlewares", "handlers"})
+		for _, r := range routes {
+			_ = cw.Write([]string{r.Path, r.Method, r.Name, r.Group, r.Auth,
+				strings.Join(r.Middlewares, ";"), strings.Join(r.Handlers, ";")})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unsupported route table format %q", format)
+}
@@ -0,0 +1,60 @@
+package httpserver
+
+import (
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDescribeRoutes(t *testing.T) {
+	h := func(c *fiber.Ctx) error { return nil }
+
+	app := fiber.New()
+	tracked := trackRoutes(app)
+	app.Use(func(c *fiber.Ctx) error { return c.Next() })
+	app.Get("/health", h)
+	app.All("/proxy", h)
+	v1 := app.Group("/v1", middleware.Authorize(nil, false))
+	v1.Get("/items", h)
+	v1.Post("/items", middleware.Authorize(nil), h)
+	v1.Delete("/items", middleware.Authorize(nil), middleware.RequireRoles(sdkcm.SysRoleRoot), h)
+
+	infos := describeRoutes(app.Stack(), tracked)
+	got := map[string]RouteInfo{}
+	for _, r := range infos {
+		got[r.Method+" "+r.Path] = r
+	}
+
+	tests := []struct {
+		route       string
+		group       string
+		auth        string
+		middlewares int
+	}{
+		{"GET /health", "", "", 1},
+		{"GET /proxy", "", "", 1},
+		{"PATCH /proxy", "", "", 1},
+		{"GET /v1/items", "/v1", middleware.AuthOptional, 2},
+		{"POST /v1/items", "/v1", middleware.AuthRequired, 2},
+		{"DELETE /v1/items", "/v1", middleware.AuthRoles, 2},
+	}
+	for _, tt := range tests {
+		r, ok := got[tt.route]
+		if !ok {
+			t.Errorf("route %s is missing", tt.route)
+			continue
+		}
+		if r.Group != tt.group || r.Auth != tt.auth || len(r.Middlewares) != tt.middlewares {
+			t.Errorf("route %s = %+v, want group %q auth %q and %d middlewares", tt.route, r, tt.group, tt.auth, tt.middlewares)
+		}
+	}
+
+	// middlewares and HEAD routes of GET routes are not listed
+	for _, route := range []string{"GET /", "GET /v1", "HEAD /health"} {
+		if _, ok := got[route]; ok {
+			t.Errorf("route %s is listed", route)
+		}
+	}
+}
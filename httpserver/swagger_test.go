@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/go-sdk/v2/logger"
+)
+
+func TestSwaggerUIAssets(t *testing.T) {
+	logger.InitServLogger(false)
+	dir, err := ioutil.TempDir("", "swagger-ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "swagger-ui.css"), []byte("body{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		assets    string
+		integrity string
+		wantPage  string
+		wantErr   bool
+	}{
+		{"default", "", "", "swagger-ui-dist@", false},
+		{"directory", "file:" + dir, "", `href="` + SwaggerUIAssetsPath + `/swagger-ui.css"`, false},
+		{"integrity", "", "sha384-a,sha384-b", `integrity="sha384-b"`, false},
+		{"invalid integrity", "", "sha1-a", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewNamed("test", "docs", 9000, nil)
+			fs.ServeSwaggerUI, fs.SwaggerUIAssets, fs.SwaggerUIIntegrity = true, tt.assets, tt.integrity
+			fs.logger, fs.inflight = logger.GetCurrent().GetLogger("test"), middleware.NewInFlight()
+
+			app, tracked, err := fs.newApp()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newApp() err = %v, want err %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			fs.register(app, tracked)
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, SwaggerUIPath, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, _ := ioutil.ReadAll(resp.Body)
+			if !strings.Contains(string(page), tt.wantPage) {
+				t.Errorf("page has no %s:\n%s", tt.wantPage, page)
+			}
+
+			resp, err = app.Test(httptest.NewRequest(http.MethodGet, SwaggerUIAssetsPath+"/swagger-ui.css", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if served := resp.StatusCode == http.StatusOK; served != strings.HasPrefix(tt.assets, "file:") {
+				t.Errorf("assets status = %d", resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/go-sdk/v2/util/filewatch"
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+
+	tlsClientAuths = map[string]tls.ClientAuthType{
+		"none":               tls.NoClientCert,
+		"request":            tls.RequestClientCert,
+		"require":            tls.RequireAnyClientCert,
+		"verify-if-given":    tls.VerifyClientCertIfGiven,
+		"require-and-verify": tls.RequireAndVerifyClientCert,
+	}
+)
+
+type TLSConfig struct {
+	CertFile     string `json:"http_tls_cert_file"`
+	KeyFile      string `json:"http_tls_key_file"`
+	ClientCAFile string `json:"http_tls_client_ca_file"`
+	MinVersion   string `json:"http_tls_min_version"`
+	// none | request | require | verify-if-given | require-and-verify,
+	// empty means require-and-verify if ClientCAFile is set, otherwise none
+	ClientAuth string `json:"http_tls_client_auth"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+func (c TLSConfig) validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("both tls cert file and key file are required")
+	}
+	if _, ok := tlsVersions[c.MinVersion]; !ok {
+		return fmt.Errorf("unsupported tls min version %q", c.MinVersion)
+	}
+	if _, ok := tlsClientAuths[c.ClientAuth]; !ok && c.ClientAuth != "" {
+		return fmt.Errorf("unsupported tls client auth %q", c.ClientAuth)
+	}
+	if c.ClientCAFile == "" && c.ClientAuth != "" && tlsClientAuths[c.ClientAuth] >= tls.VerifyClientCertIfGiven {
+		return fmt.Errorf("tls client auth %q requires a client CA file", c.ClientAuth)
+	}
+	return nil
+}
+
+// certReloader serves TLS with the certificates on disk, they are reloaded
+// when files changed (ex: rotated by cert-manager) without restarting
+type certReloader struct {
+	cfg     TLSConfig
+	logger  logger.Logger
+	current atomic.Value // *tls.Config
+	watcher *filewatch.Watcher
+}
+
+func newCertReloader(cfg TLSConfig, logger logger.Logger) (*certReloader, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	r := &certReloader{cfg: cfg, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	files := []string{cfg.CertFile, cfg.KeyFile}
+	if cfg.ClientCAFile != "" {
+		files = append(files, cfg.ClientCAFile)
+	}
+	r.watcher = filewatch.New(files, filewatch.WithLogger(logger))
+
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	conf := &tls.Config{
+		MinVersion:   tlsVersions[r.cfg.MinVersion],
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"http/1.1"},
+	}
+
+	if r.cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", r.cfg.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if r.cfg.ClientAuth != "" {
+		conf.ClientAuth = tlsClientAuths[r.cfg.ClientAuth]
+	}
+
+	r.current.Store(conf)
+	return nil
+}
+
+// watch reloads certificates until stop is called,
+// the old ones are kept if the new ones are invalid
+func (r *certReloader) watch() {
+	_ = r.watcher.Watch(func(files []string) {
+		if err := r.load(); err != nil {
+			r.logger.Errorf("reloading tls certificates: %s, keep serving the old ones", err.Error())
+			return
+		}
+		r.logger.Infof("tls certificates reloaded (%s)", strings.Join(files, ", "))
+	})
+}
+
+func (r *certReloader) stop() {
+	r.watcher.Stop()
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	conf := r.current.Load().(*tls.Config)
+	return &tls.Config{
+		MinVersion: conf.MinVersion,
+		NextProtos: conf.NextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load().(*tls.Config), nil
+		},
+	}
+}
+
+func (r *certReloader) listener(lis net.Listener) net.Listener {
+	return tls.NewListener(lis, r.tlsConfig())
+}
@@ -0,0 +1,213 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+)
+
+func TestTLSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		wantErr bool
+	}{
+		{"cert and key", TLSConfig{CertFile: "c", KeyFile: "k", MinVersion: "1.2"}, false},
+		{"no key", TLSConfig{CertFile: "c", MinVersion: "1.2"}, true},
+		{"unknown version", TLSConfig{CertFile: "c", KeyFile: "k", MinVersion: "1.4"}, true},
+		{"unknown client auth", TLSConfig{CertFile: "c", KeyFile: "k", MinVersion: "1.2", ClientAuth: "any"}, true},
+		{"verify without CA", TLSConfig{CertFile: "c", KeyFile: "k", MinVersion: "1.2", ClientAuth: "require-and-verify"}, true},
+		{"request without CA", TLSConfig{CertFile: "c", KeyFile: "k", MinVersion: "1.2", ClientAuth: "request"}, false},
+		{"mutual tls", TLSConfig{CertFile: "c", KeyFile: "k", ClientCAFile: "ca", MinVersion: "1.3"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() err = %v, want err %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testCert is a self-signed certificate, it is its own CA
+type testCert struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCert{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	if err := ioutil.WriteFile(certFile, c.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, c.keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS accepts connections of lis and completes their handshake
+func serveTLS(lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// dialTLS returns the common name of the server certificate
+func dialTLS(addr string, root *x509.Certificate, client *testCert) (string, error) {
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+	conf := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	if client != nil {
+		cert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+		if err != nil {
+			return "", err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	conn, err := tls.Dial("tcp", addr, conf)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// client certificates are verified after the handshake of the client in TLS 1.3
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil && err != io.EOF {
+		return "", err
+	}
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestCertReloader(t *testing.T) {
+	logger.InitServLogger(false)
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	first, second, client, stranger := newTestCert(t, "first"), newTestCert(t, "second"), newTestCert(t, "client"), newTestCert(t, "stranger")
+	first.write(t, certFile, keyFile)
+	if err := ioutil.WriteFile(caFile, client.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, MinVersion: "1.2"},
+		logger.GetCurrent().GetLogger("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := r.listener(tcp)
+	defer lis.Close()
+	go serveTLS(lis)
+	addr := tcp.Addr().String()
+
+	tests := []struct {
+		name    string
+		root    testCert
+		client  *testCert
+		wantCN  string
+		wantErr bool
+	}{
+		{name: "client of the CA", root: first, client: &client, wantCN: "first"},
+		{name: "no client certificate", root: first, wantErr: true},
+		{name: "client of another CA", root: first, client: &stranger, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cn, err := dialTLS(addr, tt.root.cert, tt.client)
+			if (err != nil) != tt.wantErr || cn != tt.wantCN && !tt.wantErr {
+				t.Errorf("dial = %q, %v, want %q, err %v", cn, err, tt.wantCN, tt.wantErr)
+			}
+		})
+	}
+
+	// rotated certificates are served by the same listener
+	second.write(t, certFile, keyFile)
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	if cn, err := dialTLS(addr, second.cert, &client); err != nil || cn != "second" {
+		t.Errorf("after rotation dial = %q, %v, want second", cn, err)
+	}
+
+	// invalid files keep the current certificates
+	if err := ioutil.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.load(); err == nil {
+		t.Error("load() of a broken key err = nil")
+	}
+	if cn, err := dialTLS(addr, second.cert, &client); err != nil || cn != "second" {
+		t.Errorf("after a broken rotation dial = %q, %v, want second", cn, err)
+	}
+}
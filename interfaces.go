@@ -3,8 +3,13 @@
 package goservice
 
 import (
+	"github.com/baozhenglab/go-sdk/v2/httpserver"
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/go-sdk/v2/httpserver/openapi"
 	"github.com/baozhenglab/go-sdk/v2/logger"
 	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Convenience option method for creating/initializing a service
@@ -16,6 +21,9 @@ type HttpServerHandler = func(*fiber.App)
 // A kind of server job
 type Function func(ServiceContext) error
 
+// Handler is called when value of a dynamic flag changed at runtime
+type ConfigChangeHandler func(name, oldValue, newValue string)
+
 // The storage store all db connection in service
 type Storage interface {
 	Get(prefix string) (interface{}, bool)
@@ -43,6 +51,9 @@ type Service interface {
 	Version() string
 	// Gin HTTP Server wrapper
 	HTTPServer() HttpServer
+	// HTTP server declared by WithHTTPServer, nil if it is not declared.
+	// httpserver.DefaultServer is the server returned by HTTPServer
+	NamedHTTPServer(name string) HttpServer
 	// Init with options, they can be db connections or
 	// anything the service need handle before starting
 	Init() error
@@ -53,12 +64,19 @@ type Service interface {
 	Start() error
 	// Stop service and its all component.
 	Stop()
+	// Reload dynamic flags and HTTP servers without dropping connections,
+	// it is called on SIGHUP
+	Reload() error
 	// Method export all flags to std/terminal
 	// We might use: "> .env" to move its content .env file
 	OutEnv()
 
-	//Router table
-	RouteTable()
+	// Write routes to stdout: table | json | csv, default table
+	RouteTable(format ...string) error
+
+	// Manage encrypted values of env files: encrypt | decrypt | rotate | keygen.
+	// Create runs it instead of the service when the command line is "<app> secrets ..."
+	Secrets(args []string) error
 
 	SetHTTPServer(has bool) Service
 
@@ -74,6 +92,15 @@ type ServiceContext interface {
 	Get(prefix string) (interface{}, bool)
 	MustGet(prefix string) interface{}
 	Env() string
+	// Tracer of OpenTelemetry, it's a no-op tracer when tracing is disabled
+	Tracer(name string) trace.Tracer
+	// Prometheus registry to register custom counters, gauges and histograms
+	Metrics() *prometheus.Registry
+	// Subscribe changes of a dynamic flag (see WithDynamicFlags), handlers
+	// apply the new value, variables bound to the flag are not written
+	OnConfigChange(flagName string, hdl ConfigChangeHandler)
+	// Current value of a flag, including reloaded values of dynamic flags
+	ConfigValue(flagName string) string
 }
 
 // Runnable is an abstract object in SDK
@@ -93,19 +120,34 @@ type HttpServer interface {
 	// Add handlers to GIN
 	AddHandler(HttpServerHandler)
 	// Return server config
-	//GetConfig() http_server.Config
+	GetConfig() httpserver.Config
+	// Apply a new config without dropping connections, the old app is drained
+	Reload(httpserver.Config) error
+	// Function called by POST requests of the reload path (-fiber-reload-path)
+	SetReloader(func() error)
 	// URI that the server is listening
 	URI() string
 
 	AddMiddleware(fiber.Handler)
+	// Custom shape of error responses, instead of AppError or problem details
+	SetErrorRenderer(middleware.ErrorRenderer)
 
 	Routes() [][]*fiber.Route
+	// Routes with their group, middlewares and auth requirement
+	RouteInfos() ([]httpserver.RouteInfo, error)
+	// OpenAPI document of routes annotated by openapi.Doc
+	OpenAPI() (*openapi.Document, error)
+	// Name of the server, httpserver.DefaultServer for the default one
+	ServerName() string
+	// Whether the server is stopping and draining in-flight requests,
+	// custom readiness probes should fail then
+	Draining() bool
 }
 
-//Config init flag for other config without init service
-//Example set jwt key,...
-//Service Provider for service thirth party
-//Example: Telegram bot, elasticsearch, prdiction IO,...
+// Config init flag for other config without init service
+// Example set jwt key,...
+// Service Provider for service thirth party
+// Example: Telegram bot, elasticsearch, prdiction IO,...
 type PrefixConfigure interface {
 	InitFlags()
 	HasPrefix
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields bound to goroutines, they are added to every log line written
+// by the goroutine. The http server binds the request ID while handling
+// a request, goroutines started by handlers don't inherit them: they log
+// with WithContext(c.UserContext())
+var (
+	boundFields sync.Map // goroutine id => Fields
+	boundCount  int64
+)
+
+// BindFields adds fields to all logs of the current goroutine until unbind is called.
+// Fields bound before are merged, and restored by unbind
+func BindFields(fields Fields) (unbind func()) {
+	id := goroutineID()
+	prev, hadPrev := boundFields.Load(id)
+
+	merged := Fields{}
+	if hadPrev {
+		for k, v := range prev.(Fields) {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	boundFields.Store(id, merged)
+	atomic.AddInt64(&boundCount, 1)
+
+	return func() {
+		if hadPrev {
+			boundFields.Store(id, prev)
+		} else {
+			boundFields.Delete(id)
+		}
+		atomic.AddInt64(&boundCount, -1)
+	}
+}
+
+func currentBoundFields() Fields {
+	if atomic.LoadInt64(&boundCount) == 0 {
+		return nil
+	}
+	if fields, ok := boundFields.Load(goroutineID()); ok {
+		return fields.(Fields)
+	}
+	return nil
+}
+
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	// "goroutine 123 [running]: ..."
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// boundFieldsHook adds bound fields of the goroutine to log entries
+type boundFieldsHook struct{}
+
+func (boundFieldsHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (boundFieldsHook) Fire(entry *logrus.Entry) error {
+	fields := currentBoundFields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// Data is shared with the parent entry, so never modify it in place
+	data := make(logrus.Fields, len(entry.Data)+len(fields))
+	for k, v := range fields {
+		data[k] = v
+	}
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	entry.Data = data
+	return nil
+}
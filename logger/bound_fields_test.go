@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"testing"
+)
+
+func TestBindFields(t *testing.T) {
+	unbind := BindFields(Fields{"request_id": "a", "user": 1})
+	inner := BindFields(Fields{"user": 2})
+
+	tests := []struct {
+		name   string
+		unbind func()
+		want   Fields
+	}{
+		{"nested are merged", func() {}, Fields{"request_id": "a", "user": 2}},
+		{"unbind restores", inner, Fields{"request_id": "a", "user": 1}},
+		{"all unbound", unbind, nil},
+	}
+	for _, tt := range tests {
+		tt.unbind()
+		got := currentBoundFields()
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: fields = %v, want %v", tt.name, got, tt.want)
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %v, want %v", tt.name, k, got[k], v)
+			}
+		}
+	}
+
+	// other goroutines don't see fields of this one
+	defer BindFields(Fields{"request_id": "b"})()
+	done := make(chan Fields)
+	go func() { done <- currentBoundFields() }()
+	if got := <-done; got != nil {
+		t.Errorf("fields of another goroutine = %v, want none", got)
+	}
+}
@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fieldsKey struct{}
+
+// NewContext returns a copy of ctx carrying fields, they are added to logs
+// by Logger.WithContext. Ex: the http server adds the request ID to
+// c.UserContext(), so log.WithContext(c.UserContext()) logs it
+func NewContext(ctx context.Context, fields Fields) context.Context {
+	merged := Fields{}
+	for k, v := range FieldsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FieldsFromContext returns fields carried by ctx, nil if there are none
+func FieldsFromContext(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).(Fields)
+	return fields
+}
+
+func (l *logger) WithContext(ctx context.Context) Logger {
+	fields := FieldsFromContext(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return &logger{l.Entry.WithFields(logrus.Fields(fields))}
+}
@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestWithContext(t *testing.T) {
+	base := context.Background()
+	ctx := NewContext(base, Fields{"request_id": "abc", "user": 1})
+	// fields of the parent context are kept, new values win
+	ctx = NewContext(ctx, Fields{"user": 2})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want Fields
+	}{
+		{"no fields", base, Fields{"prefix": "test"}},
+		{"nil context", nil, Fields{"prefix": "test"}},
+		{"fields", ctx, Fields{"prefix": "test", "request_id": "abc", "user": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &logger{logrus.NewEntry(logrus.New()).WithField("prefix", "test")}
+			got := l.WithContext(tt.ctx).(*logger).Entry.Data
+			if len(got) != len(tt.want) {
+				t.Fatalf("fields = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+
+	if got := FieldsFromContext(NewContext(base, Fields{"a": 1})); len(FieldsFromContext(base)) != 0 || got["a"] != 1 {
+		t.Errorf("FieldsFromContext() = %v", got)
+	}
+}
@@ -4,6 +4,7 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"runtime"
@@ -58,6 +59,8 @@ type Logger interface {
 	Withs(Fields) Logger
 	// add source field to log
 	WithSrc() Logger
+	// add fields carried by ctx, see NewContext
+	WithContext(ctx context.Context) Logger
 	GetLevel() string
 }
 
@@ -106,7 +109,7 @@ func (l *logger) Debugf(format string, args ...interface{}) {
 
 func (l *logger) Print(args ...interface{}) {
 	if l.Entry.Logger.Level >= logrus.DebugLevel {
-		l.debugSrc().Debug(args)
+		l.debugSrc().Debug(args...)
 	}
 }
 
@@ -3,6 +3,7 @@ package logger
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strings"
@@ -56,6 +57,8 @@ func NewAppLogService(config *Config) *stdLogger {
 		},
 	})
 
+	logger.AddHook(boundFieldsHook{})
+
 	return &stdLogger{
 		logger:   logger,
 		cfg:      *config,
@@ -98,3 +101,18 @@ func (s *stdLogger) Stop() <-chan bool {
 
 	return c
 }
+
+// SetOutput changes where logs are written, ex: to capture them in tests
+func (s *stdLogger) SetOutput(w io.Writer) {
+	s.logger.SetOutput(w)
+}
+
+// SetLevel changes log level at runtime, ex: when config is reloaded
+func (s *stdLogger) SetLevel(level string) error {
+	lv, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	s.logger.SetLevel(lv)
+	return nil
+}
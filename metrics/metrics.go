@@ -0,0 +1,173 @@
+// Prometheus metrics provider
+//
+// All components share one registry, it already has Go runtime and
+// process collectors. Metrics are exposed on one of the fiber servers
+// (see -metrics-http-server) or on a separate admin port.
+package metrics
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	registry = newRegistry()
+	enabled  int32
+	path     = "/metrics"
+	// name of the fiber server which serves metrics when there is no admin port
+	httpServer atomic.Value
+)
+
+func newRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// Registry is used to register custom counters, gauges and histograms
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// IsEnabled reports whether metrics are collected and exposed
+func IsEnabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// ServedByHTTPServer reports whether a fiber server must expose metrics at Path()
+func ServedByHTTPServer() bool {
+	server, _ := httpServer.Load().(string)
+	return server != ""
+}
+
+// ServedBy reports whether the named fiber server must expose metrics at Path()
+func ServedBy(server string) bool {
+	s, _ := httpServer.Load().(string)
+	return s != "" && s == server
+}
+
+func Path() string {
+	return path
+}
+
+// Handler serves metrics of the registry in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+type Config struct {
+	Enabled  bool   `json:"metrics_enabled"`
+	Path     string `json:"metrics_path"`
+	Port     int    `json:"metrics_port"`
+	BindAddr string `json:"metrics_bind_addr"`
+	// fiber server which exposes metrics when Port is 0
+	HTTPServer string `json:"metrics_http_server"`
+}
+
+type metricsService struct {
+	Config
+	logger logger.Logger
+	mu     sync.Mutex
+	server *http.Server
+}
+
+func New() *metricsService {
+	return &metricsService{}
+}
+
+func (ms *metricsService) Name() string { return "metrics" }
+
+func (ms *metricsService) InitFlags() {
+	prefix := "metrics-"
+	flag.BoolVar(&ms.Enabled, prefix+"enabled", false, "Collect and expose Prometheus metrics")
+	flag.StringVar(&ms.Path, prefix+"path", "/metrics", "Path of the metrics endpoint")
+	flag.IntVar(&ms.Port, prefix+"port", 0, "Admin port to expose metrics. If 0 => expose on the fiber server")
+	flag.StringVar(&ms.BindAddr, prefix+"addr", "", "Bind address of the admin port")
+	flag.StringVar(&ms.HTTPServer, prefix+"http-server", "default",
+		"Name of the fiber server exposing metrics when there is no admin port, ex: admin")
+}
+
+func (ms *metricsService) Configure() error {
+	ms.logger = logger.GetCurrent().GetLogger("metrics")
+
+	if !ms.Enabled {
+		return nil
+	}
+
+	if !strings.HasPrefix(ms.Path, "/") {
+		return fmt.Errorf("metrics path %q must start with /", ms.Path)
+	}
+	path = ms.Path
+
+	if ms.Port == 0 {
+		if ms.HTTPServer == "" {
+			return fmt.Errorf("metrics-http-server is required when metrics-port is 0")
+		}
+		httpServer.Store(ms.HTTPServer)
+	}
+	atomic.StoreInt32(&enabled, 1)
+	return nil
+}
+
+func (ms *metricsService) Run() error {
+	if !ms.Enabled || ms.Port == 0 {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(ms.Path, Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	addr := net.JoinHostPort(ms.BindAddr, fmt.Sprint(ms.Port))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	ms.server = server
+	ms.mu.Unlock()
+
+	ms.logger.Infof("serve metrics on %s%s", lis.Addr().String(), ms.Path)
+	if err := server.Serve(lis); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (ms *metricsService) Stop() <-chan bool {
+	c := make(chan bool)
+	go func() {
+		ms.mu.Lock()
+		server := ms.server
+		ms.mu.Unlock()
+
+		if server != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = server.Shutdown(ctx)
+			cancel()
+		}
+		c <- true
+	}()
+	return c
+}
+
+// Registry of the service, see Registry
+func (ms *metricsService) Registry() *prometheus.Registry {
+	return registry
+}
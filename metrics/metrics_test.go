@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+)
+
+func TestServedBy(t *testing.T) {
+	logger.InitServLogger(false)
+	tests := []struct {
+		name    string
+		cfg     Config
+		server  string
+		want    bool
+		wantErr bool
+	}{
+		{"default server", Config{Enabled: true, Path: "/metrics", HTTPServer: "default"}, "default", true, false},
+		{"named server", Config{Enabled: true, Path: "/metrics", HTTPServer: "admin"}, "admin", true, false},
+		{"other server", Config{Enabled: true, Path: "/metrics", HTTPServer: "admin"}, "default", false, false},
+		{"admin port", Config{Enabled: true, Path: "/metrics", Port: 9100, HTTPServer: "admin"}, "admin", false, false},
+		{"no server", Config{Enabled: true, Path: "/metrics"}, "default", false, true},
+		{"invalid path", Config{Enabled: true, Path: "metrics", HTTPServer: "default"}, "default", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpServer.Store("")
+			ms := New()
+			ms.Config = tt.cfg
+			if err := ms.Configure(); (err != nil) != tt.wantErr {
+				t.Fatalf("Configure() err = %v, want err %v", err, tt.wantErr)
+			}
+			if got := ServedBy(tt.server); got != tt.want {
+				t.Errorf("ServedBy(%s) = %v, want %v", tt.server, got, tt.want)
+			}
+			// some server serves metrics when there is no admin port
+			if want := tt.cfg.Port == 0 && !tt.wantErr; ServedByHTTPServer() != want {
+				t.Errorf("ServedByHTTPServer() = %v, want %v", ServedByHTTPServer(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Rate limiting of the fiber server
+//
+// Limits are declared as rules, by code or by the -<prefix>-rules flag,
+// and applied per route group with Middleware or Named. Requests are
+// counted by IP, by the current user or by API key in a pluggable store:
+// memory (per instance) or a server speaking the Redis protocol (shared).
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/sdkcm"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+const (
+	HeaderLimit      = "RateLimit-Limit"
+	HeaderRemaining  = "RateLimit-Remaining"
+	HeaderReset      = "RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+	HeaderAPIKey     = "X-API-Key"
+)
+
+var ErrTooManyRequests = sdkcm.CustomError("ErrTooManyRequests", "too many requests")
+
+// KeyFunc returns the client of a request, requests of a client share a limit
+type KeyFunc func(c *fiber.Ctx) string
+
+// ByIP limits requests per client IP
+func ByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// ByUser limits requests per user set by Authorize, guests are limited per IP
+func ByUser(c *fiber.Ctx) string {
+	if id, ok := middleware.CurrentUserID(c); ok {
+		return "user:" + strconv.FormatUint(uint64(id), 10)
+	}
+	return ByIP(c)
+}
+
+// ByAPIKey limits requests per API key in the header, requests without key are limited per IP.
+// Keys are hashed, so they are never readable in the store
+func ByAPIKey(header string) KeyFunc {
+	return func(c *fiber.Ctx) string {
+		if key := c.Get(header); key != "" {
+			sum := sha256.Sum256([]byte(key))
+			return "key:" + hex.EncodeToString(sum[:])
+		}
+		return ByIP(c)
+	}
+}
+
+type Rule struct {
+	// Name is a part of store keys, rules with the same name share limits
+	Name      string
+	Limit     int
+	Period    time.Duration
+	Algorithm Algorithm
+	// Key is ByIP when nil
+	Key KeyFunc
+}
+
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("name of rule is required")
+	}
+	if r.Limit <= 0 || r.Period <= 0 {
+		return fmt.Errorf("rule %s must have positive limit and period", r.Name)
+	}
+	if r.Algorithm != TokenBucket && r.Algorithm != SlidingWindow {
+		return fmt.Errorf("rule %s has unsupported algorithm %q", r.Name, r.Algorithm)
+	}
+	return nil
+}
+
+type Config struct {
+	Store         string `json:"ratelimit_store"`
+	Rules         string `json:"ratelimit_rules"`
+	KeyPrefix     string `json:"ratelimit_key_prefix"`
+	RedisAddr     string `json:"ratelimit_redis_addr"`
+	RedisPassword string `json:"ratelimit_redis_password"`
+	RedisDB       int    `json:"ratelimit_redis_db"`
+	RedisPoolSize int    `json:"ratelimit_redis_pool_size"`
+	// requests are allowed when the store fails
+	FailOpen bool `json:"ratelimit_fail_open"`
+}
+
+type Limiter interface {
+	// Middleware limits requests of a route group by the rule, it fails if the rule is invalid
+	Middleware(rule Rule) (fiber.Handler, error)
+	// Named limits requests by a rule of the -<prefix>-rules flag. It panics when
+	// the limiter is configured and the rule is not declared, so the service fails
+	// at startup. Before Configure, the rule is looked up by the first request
+	Named(name string) fiber.Handler
+	// Take counts a request of the key, for limits outside of HTTP handlers
+	Take(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+type limiter struct {
+	Config
+	prefix string
+	logger logger.Logger
+	store  Store
+	rules  map[string]Rule
+	// rules are parsed
+	configured bool
+}
+
+// New limiter component, store is optional, it is chosen by flags when nil
+func New(prefix string, store ...Store) *limiter {
+	l := &limiter{prefix: prefix, rules: map[string]Rule{}}
+	if len(store) > 0 {
+		l.store = store[0]
+	}
+	return l
+}
+
+func (l *limiter) GetPrefix() string { return l.prefix }
+
+func (l *limiter) Get() interface{} { return l }
+
+func (l *limiter) Name() string { return l.prefix }
+
+func (l *limiter) InitFlags() {
+	prefix := l.prefix + "-"
+	flag.StringVar(&l.Store, prefix+"store", StoreMemory, "Store of rate limits: memory | redis")
+	flag.StringVar(&l.Rules, prefix+"rules", "",
+		"Named rules, name=limit/period[:ip|user|api-key[:token-bucket|sliding-window]] separated by comma. Ex: api=100/1m:user")
+	flag.StringVar(&l.KeyPrefix, prefix+"key-prefix", "ratelimit", "Prefix of keys in the store")
+	flag.StringVar(&l.RedisAddr, prefix+"redis-addr", "localhost:6379", "Address of the Redis store")
+	flag.StringVar(&l.RedisPassword, prefix+"redis-password", "", "Password of the Redis store")
+	flag.IntVar(&l.RedisDB, prefix+"redis-db", 0, "Database of the Redis store")
+	flag.IntVar(&l.RedisPoolSize, prefix+"redis-pool-size", 10, "Idle connections to the Redis store")
+	flag.BoolVar(&l.FailOpen, prefix+"fail-open", true, "Allow requests when the store is unavailable")
+}
+
+func (l *limiter) Configure() error {
+	l.logger = logger.GetCurrent().GetLogger(l.prefix)
+
+	rules, err := parseRules(l.Rules)
+	if err != nil {
+		return err
+	}
+	l.rules = rules
+	l.configured = true
+
+	if l.store != nil {
+		return nil
+	}
+
+	switch l.Store {
+	case StoreMemory:
+		l.store = NewMemoryStore()
+	case StoreRedis:
+		store := NewRedisStore(RedisConfig{
+			Addr:     l.RedisAddr,
+			Password: l.RedisPassword,
+			DB:       l.RedisDB,
+			PoolSize: l.RedisPoolSize,
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := store.Ping(ctx); err != nil {
+			return fmt.Errorf("cannot connect to rate limit store %s: %v", l.RedisAddr, err)
+		}
+		l.store = store
+	default:
+		return fmt.Errorf("unsupported rate limit store %q", l.Store)
+	}
+	return nil
+}
+
+// Run configures the limiter, init components are only run by the service
+func (l *limiter) Run() error {
+	return l.Configure()
+}
+
+func (l *limiter) Stop() <-chan bool {
+	c := make(chan bool)
+	go func() {
+		if l.store != nil {
+			_ = l.store.Close()
+		}
+		c <- true
+	}()
+	return c
+}
+
+// parseRules parses name=limit/period[:key[:algorithm]] separated by comma
+func parseRules(s string) (map[string]Rule, error) {
+	rules := map[string]Rule{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rate limit rule %q", item)
+		}
+
+		parts := strings.Split(kv[1], ":")
+		rate := strings.SplitN(parts[0], "/", 2)
+		if len(rate) != 2 {
+			return nil, fmt.Errorf("invalid rate of rule %q, ex: 100/1m", item)
+		}
+
+		limit, err := strconv.Atoi(rate[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit of rule %q", item)
+		}
+
+		// 1m can be written as m
+		period, err := time.ParseDuration(rate[1])
+		if err != nil {
+			if period, err = time.ParseDuration("1" + rate[1]); err != nil {
+				return nil, fmt.Errorf("invalid period of rule %q", item)
+			}
+		}
+
+		rule := Rule{Name: strings.TrimSpace(kv[0]), Limit: limit, Period: period, Algorithm: TokenBucket, Key: ByIP}
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "ip":
+			case "user":
+				rule.Key = ByUser
+			case "api-key":
+				rule.Key = ByAPIKey(HeaderAPIKey)
+			default:
+				return nil, fmt.Errorf("unsupported key %q of rule %q", parts[1], item)
+			}
+		}
+		if len(parts) > 2 {
+			rule.Algorithm = Algorithm(parts[2])
+		}
+
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		rules[rule.Name] = rule
+	}
+	return rules, nil
+}
+
+func (l *limiter) Take(ctx context.Context, key string, rule Rule) (Result, error) {
+	if rule.Algorithm == "" {
+		rule.Algorithm = TokenBucket
+	}
+	return l.store.Take(ctx, l.KeyPrefix+":"+rule.Name+":"+key, rule.Limit, rule.Period, rule.Algorithm)
+}
+
+func (l *limiter) Named(name string) fiber.Handler {
+	if l.configured {
+		rule, ok := l.rules[name]
+		if !ok {
+			panic(fmt.Sprintf("ratelimit: rule %s is not declared by -%s-rules", name, l.prefix))
+		}
+		return func(c *fiber.Ctx) error {
+			return l.limit(c, rule)
+		}
+	}
+
+	var once sync.Once
+	return func(c *fiber.Ctx) error {
+		rule, ok := l.rules[name]
+		if !ok {
+			err := fmt.Errorf("rate limit rule %s is not declared by -%s-rules", name, l.prefix)
+			once.Do(func() { logger.GetCurrent().GetLogger(l.prefix).Errorln(err) })
+			return sdkcm.NewAppErr(err, http.StatusInternalServerError, "rate limit is misconfigured").WithCode("ErrRateLimitRule")
+		}
+		return l.limit(c, rule)
+	}
+}
+
+func (l *limiter) Middleware(rule Rule) (fiber.Handler, error) {
+	if rule.Algorithm == "" {
+		rule.Algorithm = TokenBucket
+	}
+	if rule.Key == nil {
+		rule.Key = ByIP
+	}
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+
+	return func(c *fiber.Ctx) error {
+		return l.limit(c, rule)
+	}, nil
+}
+
+func (l *limiter) limit(c *fiber.Ctx, rule Rule) error {
+	res, err := l.Take(c.UserContext(), rule.Key(c), rule)
+	if err != nil {
+		if l.FailOpen {
+			l.logger.Errorln("rate limit store:", err)
+			return c.Next()
+		}
+		return sdkcm.NewAppErr(err, http.StatusServiceUnavailable, "rate limit is unavailable").WithCode("ErrRateLimitStore")
+	}
+
+	c.Set(HeaderLimit, strconv.Itoa(res.Limit))
+	c.Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+	c.Set(HeaderReset, strconv.Itoa(seconds(res.ResetAfter)))
+
+	if !res.Allowed {
+		c.Set(HeaderRetryAfter, strconv.Itoa(seconds(res.RetryAfter)))
+		return sdkcm.NewAppErr(errors.New(ErrTooManyRequests.Error()), http.StatusTooManyRequests,
+			ErrTooManyRequests.Error()).WithCode(ErrTooManyRequests.Key())
+	}
+	return c.Next()
+}
+
+// seconds rounds up, so clients don't retry too early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
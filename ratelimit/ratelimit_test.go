@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver/middleware"
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		rules   string
+		want    map[string]Rule
+		wantErr bool
+	}{
+		{"", map[string]Rule{}, false},
+		{"api=100/1m", map[string]Rule{"api": {Name: "api", Limit: 100, Period: time.Minute, Algorithm: TokenBucket}}, false},
+		{"api=10/m:user:sliding-window, login=5/1h:api-key", map[string]Rule{
+			"api":   {Name: "api", Limit: 10, Period: time.Minute, Algorithm: SlidingWindow},
+			"login": {Name: "login", Limit: 5, Period: time.Hour, Algorithm: TokenBucket},
+		}, false},
+		{"api", nil, true},
+		{"api=100", nil, true},
+		{"api=x/1m", nil, true},
+		{"api=100/x", nil, true},
+		{"api=0/1m", nil, true},
+		{"api=100/1m:device", nil, true},
+		{"api=100/1m:ip:leaky-bucket", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rules, func(t *testing.T) {
+			got, err := parseRules(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRules() err = %v, want err %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("rules = %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				r := got[name]
+				if r.Name != want.Name || r.Limit != want.Limit || r.Period != want.Period || r.Algorithm != want.Algorithm || r.Key == nil {
+					t.Errorf("rule %s = %+v, want %+v", name, r, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareInvalidRule(t *testing.T) {
+	l := New("ratelimit", NewMemoryStore())
+	tests := []Rule{
+		{Limit: 1, Period: time.Minute},
+		{Name: "api", Period: time.Minute},
+		{Name: "api", Limit: 1},
+		{Name: "api", Limit: 1, Period: time.Minute, Algorithm: "leaky-bucket"},
+	}
+	for _, rule := range tests {
+		if h, err := l.Middleware(rule); err == nil || h != nil {
+			t.Errorf("Middleware(%+v) = %v, %v, want an error", rule, h, err)
+		}
+	}
+}
+
+func TestByAPIKey(t *testing.T) {
+	var keys []string
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		keys = append(keys, ByAPIKey(HeaderAPIKey)(c))
+		return nil
+	})
+
+	for _, key := range []string{"secret-key", "secret-key", "other-key", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set(HeaderAPIKey, key)
+		}
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if keys[0] != keys[1] || keys[0] == keys[2] {
+		t.Errorf("keys = %v, same API keys must share a limit", keys)
+	}
+	for _, k := range keys[:3] {
+		if !strings.HasPrefix(k, "key:") || strings.Contains(k, "secret") || strings.Contains(k, "other") {
+			t.Errorf("key %q is not hashed", k)
+		}
+	}
+	if !strings.HasPrefix(keys[3], "ip:") {
+		t.Errorf("key without API key = %q, want by IP", keys[3])
+	}
+}
+
+// failingStore fails every take
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, int, time.Duration, Algorithm) (Result, error) {
+	return Result{}, errors.New("store is down")
+}
+
+func (failingStore) Close() error { return nil }
+
+func TestLimit(t *testing.T) {
+	logger.InitServLogger(false)
+	log := logger.GetCurrent().GetLogger("test")
+
+	tests := []struct {
+		name       string
+		store      Store
+		failOpen   bool
+		wantStatus []int
+	}{
+		{"memory", NewMemoryStore(), false, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+		{"fail open", failingStore{}, true, []int{http.StatusOK, http.StatusOK}},
+		{"fail closed", failingStore{}, false, []int{http.StatusServiceUnavailable}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New("ratelimit", tt.store)
+			l.logger, l.FailOpen, l.KeyPrefix = log, tt.failOpen, "test"
+
+			limit, err := l.Middleware(Rule{Name: "api", Limit: 2, Period: time.Hour})
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler(log)})
+			app.Get("/", limit, func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+			for i, want := range tt.wantStatus {
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != want {
+					t.Errorf("request %d status = %d, want %d", i, resp.StatusCode, want)
+				}
+				if want == http.StatusTooManyRequests && (resp.Header.Get(HeaderRetryAfter) == "" || resp.Header.Get(HeaderRemaining) != "0") {
+					t.Errorf("headers of 429 = %v", resp.Header)
+				}
+				if tt.store != (failingStore{}) && resp.Header.Get(HeaderLimit) != "2" {
+					t.Errorf("%s = %q, want 2", HeaderLimit, resp.Header.Get(HeaderLimit))
+				}
+			}
+		})
+	}
+}
+
+func TestNamed(t *testing.T) {
+	logger.InitServLogger(false)
+	log := logger.GetCurrent().GetLogger("test")
+
+	tests := []struct {
+		name string
+		rule string
+		// Configure is called before Named, after it, or never
+		configure  string
+		wantPanic  bool
+		wantStatus []int
+		wantCode   string
+	}{
+		{"declared", "api", "before", false, []int{http.StatusOK, http.StatusTooManyRequests}, ""},
+		{"undeclared fails at startup", "admin", "before", true, nil, ""},
+		{"declared after Named", "api", "after", false, []int{http.StatusOK, http.StatusTooManyRequests}, ""},
+		{"undeclared after Named", "admin", "after", false, []int{http.StatusInternalServerError}, "ErrRateLimitRule"},
+		{"not configured", "api", "never", false, []int{http.StatusInternalServerError, http.StatusInternalServerError}, "ErrRateLimitRule"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New("ratelimit", NewMemoryStore())
+			l.Rules = "api=1/1h"
+			configure := func() {
+				if err := l.Configure(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.configure == "before" {
+				configure()
+			}
+
+			var limit fiber.Handler
+			func() {
+				defer func() {
+					if r := recover(); (r != nil) != tt.wantPanic {
+						t.Fatalf("Named(%s) panic = %v, want panic %v", tt.rule, r, tt.wantPanic)
+					}
+				}()
+				limit = l.Named(tt.rule)
+			}()
+			if tt.wantPanic {
+				return
+			}
+			if tt.configure == "after" {
+				configure()
+			}
+
+			app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler(log)})
+			app.Get("/", limit, func(c *fiber.Ctx) error { return c.SendString("ok") })
+			for i, want := range tt.wantStatus {
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != want {
+					t.Errorf("request %d status = %d, want %d", i, resp.StatusCode, want)
+				}
+				var body struct {
+					Code string `json:"code"`
+				}
+				_ = json.NewDecoder(resp.Body).Decode(&body)
+				if tt.wantCode != "" && body.Code != tt.wantCode {
+					t.Errorf("request %d code = %q, want %s", i, body.Code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scripts run atomically on the server, so instances of the service share limits.
+// Numbers are returned as strings since Redis truncates Lua numbers to integers
+const tokenBucketScript = `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil then
+  tokens = limit
+  ts = now
+end
+tokens = math.min(limit, tokens + (now - ts) * limit / period)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`
+
+const slidingWindowScript = `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+if prev * (period - elapsed) / period + cur < limit then
+  redis.call('INCR', KEYS[1])
+  redis.call('PEXPIRE', KEYS[1], period * 2)
+end
+return {prev, cur}
+`
+
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	PoolSize int
+	Timeout  time.Duration
+}
+
+// redisStore keeps limits in a server speaking the Redis protocol (RESP).
+// It only needs EVAL, so a minimal client is used instead of a driver
+type redisStore struct {
+	RedisConfig
+	pool chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func NewRedisStore(cfg RedisConfig) *redisStore {
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 10
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	return &redisStore{RedisConfig: cfg, pool: make(chan *redisConn, cfg.PoolSize)}
+}
+
+// Ping checks the connection, it is called when the limiter starts
+func (s *redisStore) Ping(ctx context.Context) error {
+	_, err := s.do(ctx, "PING")
+	return err
+}
+
+func (s *redisStore) Take(ctx context.Context, key string, limit int, period time.Duration, alg Algorithm) (Result, error) {
+	now := time.Now()
+	periodMs := int64(period / time.Millisecond)
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	if periodMs <= 0 {
+		return Result{}, fmt.Errorf("period of limit %s is too short", key)
+	}
+
+	if alg == SlidingWindow {
+		index := nowMs / periodMs
+		elapsed := nowMs - index*periodMs
+		reply, err := s.do(ctx, "EVAL", slidingWindowScript, "2",
+			key+":"+strconv.FormatInt(index, 10), key+":"+strconv.FormatInt(index-1, 10),
+			strconv.Itoa(limit), strconv.FormatInt(periodMs, 10), strconv.FormatInt(elapsed, 10))
+		if err != nil {
+			return Result{}, err
+		}
+
+		values, err := replyInts(reply, 2)
+		if err != nil {
+			return Result{}, err
+		}
+		return slidingWindow(int(values[0]), int(values[1]), time.Duration(elapsed)*time.Millisecond, limit, period), nil
+	}
+
+	reply, err := s.do(ctx, "EVAL", tokenBucketScript, "1", key,
+		strconv.Itoa(limit), strconv.FormatInt(periodMs, 10), strconv.FormatInt(nowMs, 10))
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected reply %v", reply)
+	}
+	s2, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(s2, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected reply %v", reply)
+	}
+
+	// state after the take is known, so compute the result from it
+	res := Result{Limit: limit, Allowed: values[0] == int64(1)}
+	rate := float64(limit) / float64(period)
+	if !res.Allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / rate)
+	}
+	res.Remaining = int(tokens)
+	res.ResetAfter = time.Duration((float64(limit) - tokens) / rate)
+	return res, nil
+}
+
+func replyInts(reply interface{}, n int) ([]int64, error) {
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != n {
+		return nil, fmt.Errorf("unexpected reply %v", reply)
+	}
+
+	ints := make([]int64, n)
+	for i, v := range values {
+		if ints[i], ok = v.(int64); !ok {
+			return nil, fmt.Errorf("unexpected reply %v", reply)
+		}
+	}
+	return ints, nil
+}
+
+func (s *redisStore) Close() error {
+	for {
+		select {
+		case conn := <-s.pool:
+			_ = conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (s *redisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := s.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	reply, err := conn.do(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// state of the connection is unknown
+		_ = conn.Close()
+		return nil, err
+	}
+
+	select {
+	case s.pool <- conn:
+	default:
+		_ = conn.Close()
+	}
+	return reply, err
+}
+
+func (s *redisStore) getConn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.pool:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: s.Timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	_ = conn.SetDeadline(time.Now().Add(s.Timeout))
+	if s.Password != "" {
+		if _, err := conn.do("AUTH", s.Password); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if s.DB != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(s.DB)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("malformed reply %q", line)
+}
@@ -0,0 +1,282 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis speaks RESP and runs the scripts of redisStore natively,
+// so the client is tested without a Redis server
+type fakeRedis struct {
+	lis      net.Listener
+	password string
+
+	mu       sync.Mutex
+	commands []string
+	conns    int
+	hashes   map[string][2]float64 // key => tokens, ts
+	counters map[string]int64
+	// reply of the next command, ex: an error
+	nextReply string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{lis: lis, password: password, hashes: map[string][2]float64{}, counters: map[string]int64{}}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) Addr() string { return f.lis.Addr().String() }
+
+func (f *fakeRedis) Close() { _ = f.lis.Close() }
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		reply := f.nextReply
+		f.nextReply = ""
+		if reply == "" {
+			switch {
+			case args[0] == "AUTH":
+				if authed = args[1] == f.password; authed {
+					reply = "+OK\r\n"
+				} else {
+					reply = "-WRONGPASS invalid password\r\n"
+				}
+			case !authed:
+				reply = "-NOAUTH Authentication required.\r\n"
+			default:
+				reply = f.exec(args)
+			}
+		}
+		f.mu.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("malformed command %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	switch args[0] {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "EVAL":
+		num := func(i int) float64 {
+			v, _ := strconv.ParseFloat(args[i], 64)
+			return v
+		}
+		switch args[1] {
+		case tokenBucketScript:
+			key, limit, period, now := args[3], num(4), num(5), num(6)
+			tokens, ts := limit, now
+			if h, ok := f.hashes[key]; ok {
+				tokens, ts = h[0], h[1]
+			}
+			tokens = math.Min(limit, tokens+(now-ts)*limit/period)
+			allowed := 0
+			if tokens >= 1 {
+				tokens--
+				allowed = 1
+			}
+			f.hashes[key] = [2]float64{tokens, now}
+			s := strconv.FormatFloat(tokens, 'f', -1, 64)
+			return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n", allowed, len(s), s)
+		case slidingWindowScript:
+			cur, prev := f.counters[args[3]], f.counters[args[4]]
+			limit, period, elapsed := num(5), num(6), num(7)
+			if float64(prev)*(period-elapsed)/period+float64(cur) < limit {
+				f.counters[args[3]]++
+			}
+			return fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", prev, cur)
+		}
+		return "-NOSCRIPT unknown script\r\n"
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func (f *fakeRedis) stats() ([]string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...), f.conns
+}
+
+func TestRedisStoreTake(t *testing.T) {
+	tests := []struct {
+		alg           Algorithm
+		wantAllowed   []bool
+		wantRemaining []int
+	}{
+		{TokenBucket, []bool{true, true, true, false}, []int{2, 1, 0, 0}},
+		{SlidingWindow, []bool{true, true, true, false}, []int{2, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.alg), func(t *testing.T) {
+			f := newFakeRedis(t, "")
+			defer f.Close()
+			store := NewRedisStore(RedisConfig{Addr: f.Addr()})
+			defer store.Close()
+
+			for i := range tt.wantAllowed {
+				res, err := store.Take(context.Background(), "test:"+string(tt.alg), 3, time.Hour, tt.alg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Allowed != tt.wantAllowed[i] || res.Remaining != tt.wantRemaining[i] || res.Limit != 3 {
+					t.Errorf("take %d = %+v, want allowed=%v remaining=%d", i, res, tt.wantAllowed[i], tt.wantRemaining[i])
+				}
+				if !res.Allowed && res.RetryAfter <= 0 {
+					t.Errorf("take %d is denied without RetryAfter", i)
+				}
+			}
+
+			// connections are reused
+			if _, conns := f.stats(); conns != 1 {
+				t.Errorf("connections = %d, want 1", conns)
+			}
+		})
+	}
+}
+
+func TestRedisStoreConnection(t *testing.T) {
+	tests := []struct {
+		name         string
+		password     string
+		cfg          RedisConfig
+		wantErr      bool
+		wantCommands []string
+	}{
+		{"no auth", "", RedisConfig{}, false, []string{"PING"}},
+		{"auth and db", "secret", RedisConfig{Password: "secret", DB: 2}, false, []string{"AUTH", "SELECT", "PING"}},
+		{"wrong password", "secret", RedisConfig{Password: "wrong"}, true, []string{"AUTH"}},
+		{"no password", "secret", RedisConfig{}, true, []string{"PING"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeRedis(t, tt.password)
+			defer f.Close()
+			tt.cfg.Addr = f.Addr()
+			store := NewRedisStore(tt.cfg)
+			defer store.Close()
+
+			err := store.Ping(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Ping() err = %v, want err %v", err, tt.wantErr)
+			}
+			if commands, _ := f.stats(); strings.Join(commands, " ") != strings.Join(tt.wantCommands, " ") {
+				t.Errorf("commands = %v, want %v", commands, tt.wantCommands)
+			}
+		})
+	}
+}
+
+func TestRedisStoreErrors(t *testing.T) {
+	f := newFakeRedis(t, "")
+	store := NewRedisStore(RedisConfig{Addr: f.Addr(), Timeout: 100 * time.Millisecond})
+	defer store.Close()
+	ctx := context.Background()
+
+	// errors of the server keep the connection
+	f.mu.Lock()
+	f.nextReply = "-BUSY script is running\r\n"
+	f.mu.Unlock()
+	if _, err := store.Take(ctx, "k", 1, time.Minute, TokenBucket); err == nil || !strings.Contains(err.Error(), "BUSY") {
+		t.Errorf("Take() err = %v, want the error of the server", err)
+	}
+	if _, err := store.Take(ctx, "k", 1, time.Minute, TokenBucket); err != nil {
+		t.Fatal(err)
+	}
+	if _, conns := f.stats(); conns != 1 {
+		t.Errorf("connections = %d, want 1", conns)
+	}
+
+	// malformed replies close the connection
+	f.mu.Lock()
+	f.nextReply = "?\r\n"
+	f.mu.Unlock()
+	if _, err := store.Take(ctx, "k", 1, time.Minute, TokenBucket); err == nil {
+		t.Error("Take() of a malformed reply err = nil")
+	}
+	if _, err := store.Take(ctx, "k", 1, time.Minute, TokenBucket); err != nil {
+		t.Fatal(err)
+	}
+	if _, conns := f.stats(); conns != 2 {
+		t.Errorf("connections = %d, want 2", conns)
+	}
+
+	if _, err := store.Take(ctx, "k", 1, time.Microsecond, TokenBucket); err == nil {
+		t.Error("Take() of a too short period err = nil")
+	}
+
+	f.Close()
+	_ = store.Close()
+	if err := store.Ping(ctx); err == nil {
+		t.Error("Ping() of a stopped server err = nil")
+	}
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	TokenBucket   Algorithm = "token-bucket"
+	SlidingWindow Algorithm = "sliding-window"
+)
+
+// Result of taking a request from a limit
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// time until the limit is fully reset
+	ResetAfter time.Duration
+	// time until the next request is allowed, zero if it is allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps state of limits, it must be safe for concurrent use
+// and atomic across instances of the service if it is shared
+type Store interface {
+	Take(ctx context.Context, key string, limit int, period time.Duration, alg Algorithm) (Result, error)
+	Close() error
+}
+
+// tokenBucket computes a take from a bucket which has tokens at ts,
+// the bucket is refilled at limit/period and holds at most limit tokens
+func tokenBucket(tokens float64, ts, now time.Time, limit int, period time.Duration) (float64, Result) {
+	rate := float64(limit) / float64(period)
+	tokens = math.Min(float64(limit), tokens+float64(now.Sub(ts))*rate)
+
+	res := Result{Limit: limit}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - tokens) / rate)
+	}
+
+	res.Remaining = int(math.Floor(tokens))
+	res.ResetAfter = time.Duration((float64(limit) - tokens) / rate)
+	return tokens, res
+}
+
+// slidingWindow estimates requests of the last period by weighting
+// the count of the previous fixed window
+func slidingWindow(prev, cur int, elapsed time.Duration, limit int, period time.Duration) Result {
+	weighted := float64(prev)*float64(period-elapsed)/float64(period) + float64(cur)
+
+	res := Result{Limit: limit, ResetAfter: period - elapsed}
+	if weighted < float64(limit) {
+		res.Allowed = true
+		weighted++
+	} else {
+		res.RetryAfter = period - elapsed
+	}
+
+	res.Remaining = int(math.Max(0, math.Floor(float64(limit)-weighted)))
+	return res
+}
+
+type bucket struct {
+	tokens    float64
+	ts        time.Time
+	expiredAt time.Time
+}
+
+type window struct {
+	index     int64
+	prev, cur int
+	expiredAt time.Time
+}
+
+// memoryStore keeps limits in memory, they are not shared between instances
+type memoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	windows  map[string]*window
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func NewMemoryStore() *memoryStore {
+	s := &memoryStore{
+		buckets:  map[string]*bucket{},
+		windows:  map[string]*window{},
+		stopChan: make(chan struct{}),
+	}
+	go s.cleanup(time.Minute)
+	return s
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, limit int, period time.Duration, alg Algorithm) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if alg == SlidingWindow {
+		index := now.UnixNano() / int64(period)
+		w, ok := s.windows[key]
+		if !ok {
+			w = &window{index: index}
+			s.windows[key] = w
+		}
+
+		switch {
+		case w.index == index-1:
+			w.prev, w.cur = w.cur, 0
+		case w.index < index-1:
+			w.prev, w.cur = 0, 0
+		}
+		w.index = index
+		w.expiredAt = now.Add(2 * period)
+
+		res := slidingWindow(w.prev, w.cur, time.Duration(now.UnixNano()-index*int64(period)), limit, period)
+		if res.Allowed {
+			w.cur++
+		}
+		return res, nil
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit), ts: now}
+		s.buckets[key] = b
+	}
+
+	tokens, res := tokenBucket(b.tokens, b.ts, now, limit, period)
+	b.tokens, b.ts, b.expiredAt = tokens, now, now.Add(period)
+	return res, nil
+}
+
+// cleanup removes expired limits, so memory doesn't grow with clients
+func (s *memoryStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for k, b := range s.buckets {
+				if now.After(b.expiredAt) {
+					delete(s.buckets, k)
+				}
+			}
+			for k, w := range s.windows {
+				if now.After(w.expiredAt) {
+					delete(s.windows, k)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *memoryStore) Close() error {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+	return nil
+}
@@ -0,0 +1,258 @@
+package goservice
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/baozhenglab/go-sdk/v2/util/envcrypt"
+)
+
+// Env variables holding the key to decrypt ENC[...] values of env files,
+// they are prefixed by WithEnvPrefix as well
+const (
+	secretsKeyEnv     = "secrets-key"
+	secretsKeyFileEnv = "secrets-key-file"
+)
+
+var errNoSecretsKey = errors.New("env files have encrypted values but no key is provided, " +
+	"set SECRETS_KEY or SECRETS_KEY_FILE")
+
+func (s *service) secretsEnv(name string) string {
+	if v := os.Getenv(getEnvName(s.envPrefix, name)); v != "" {
+		return v
+	}
+	return os.Getenv(getEnvName("", name))
+}
+
+// secretsKey reads the key from SECRETS_KEY or the file in SECRETS_KEY_FILE
+func (s *service) secretsKey() ([]byte, error) {
+	if key := s.secretsEnv(secretsKeyEnv); key != "" {
+		return envcrypt.ParseKey(key)
+	}
+
+	if file := s.secretsEnv(secretsKeyFileEnv); file != "" {
+		return readKeyFile(file)
+	}
+
+	return nil, errNoSecretsKey
+}
+
+func readKeyFile(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return envcrypt.ParseKey(string(data))
+}
+
+// decryptEnvValues replaces ENC[...] values by their plain values,
+// the key is only required when there is an encrypted value
+func (s *service) decryptEnvValues(values map[string]string) error {
+	var key []byte
+	for k, v := range values {
+		if !envcrypt.IsEncrypted(v) {
+			continue
+		}
+
+		if key == nil {
+			var err error
+			if key, err = s.secretsKey(); err != nil {
+				return err
+			}
+		}
+
+		plain, err := envcrypt.Decrypt(key, k, v)
+		if err != nil {
+			return fmt.Errorf("%s: %s", k, err.Error())
+		}
+		values[k] = plain
+	}
+	return nil
+}
+
+// secretsCommand is the first argument of the command line which runs Secrets
+// instead of the service, ex: ./app secrets encrypt -name DB_PASSWORD
+const secretsCommand = "secrets"
+
+const secretsUsage = `Usage: secrets <command> [options]
+
+Commands:
+  encrypt -name <VAR> [value]   encrypt a value of a variable (read from stdin if omitted)
+  decrypt -name <VAR> [value]   decrypt an ENC[...] value of a variable (read from stdin if omitted)
+  rotate <file>...              re-encrypt all ENC[...] values of env files with a new key
+  keygen                        generate a new key
+
+Values are bound to the name of their variable, as it is written in env files.
+The key is read from -key-file, $SECRETS_KEY or the file in $SECRETS_KEY_FILE.
+`
+
+// Secrets manages encrypted values of env files, args are the ones after "secrets"
+// in the command line, ex: secrets encrypt -key-file ./secret.key my-password
+func (s *service) Secrets(args []string) error {
+	fs := flag.NewFlagSet("secrets", flag.ContinueOnError)
+	keyFile := fs.String("key-file", "", "file contains the key")
+	name := fs.String("name", "", "variable of the value, used by encrypt and decrypt")
+	newKeyFile := fs.String("new-key-file", "", "file contains the new key, used by rotate")
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(os.Stderr, secretsUsage, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	cmd := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if cmd == "keygen" {
+		key, err := envcrypt.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	}
+
+	var (
+		key []byte
+		err error
+	)
+	if *keyFile != "" {
+		key, err = readKeyFile(*keyFile)
+	} else {
+		key, err = s.secretsKey()
+	}
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "encrypt", "decrypt":
+		if *name == "" {
+			return fmt.Errorf("%s requires -name of the variable", cmd)
+		}
+		value, err := argOrStdin(fs.Args())
+		if err != nil {
+			return err
+		}
+
+		var res string
+		if cmd == "encrypt" {
+			res, err = envcrypt.Encrypt(key, *name, value)
+		} else {
+			res, err = envcrypt.Decrypt(key, *name, value)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(res)
+		return nil
+	case "rotate":
+		if *newKeyFile == "" || fs.NArg() == 0 {
+			return errors.New("rotate requires -new-key-file and at least one env file")
+		}
+
+		newKey, err := readKeyFile(*newKeyFile)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range fs.Args() {
+			if err := rotateFile(file, key, newKey); err != nil {
+				return fmt.Errorf("%s: %s", file, err.Error())
+			}
+		}
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown secrets command %q", cmd)
+	}
+}
+
+// runSecretsCommand runs Secrets for the command line, it returns the exit code
+func (s *service) runSecretsCommand(args []string) int {
+	err := s.Secrets(args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 2
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "secrets:", err)
+	return 1
+}
+
+// rotateFile re-encrypts values of an env file, the file is replaced atomically
+// so a crash never leaves values encrypted by different keys
+func rotateFile(file string, oldKey, newKey []byte) error {
+	st, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	res, count, err := envcrypt.Rotate(oldKey, newKey, content)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(file, res, st.Mode()); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d value(s) rotated\n", file, count)
+	return nil
+}
+
+// writeFileAtomic writes a temp file next to file, then renames it to file
+func writeFileAtomic(file string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	// it fails once the temp file is renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func argOrStdin(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
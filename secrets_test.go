@@ -0,0 +1,134 @@
+package goservice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/util/envcrypt"
+)
+
+func secretsTestKey(t *testing.T) (string, []byte) {
+	t.Helper()
+	s, err := envcrypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := envcrypt.ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, key
+}
+
+func TestDecryptEnvValues(t *testing.T) {
+	keyStr, key := secretsTestKey(t)
+	password, err := envcrypt.Encrypt(key, "MYSVC_DB_PASSWORD", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		values  map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "plain values need no key",
+			values: map[string]string{"MYSVC_A": "a"},
+			want:   map[string]string{"MYSVC_A": "a"},
+		},
+		{
+			name:   "decrypted",
+			key:    keyStr,
+			values: map[string]string{"MYSVC_A": "a", "MYSVC_DB_PASSWORD": password},
+			want:   map[string]string{"MYSVC_A": "a", "MYSVC_DB_PASSWORD": "pass"},
+		},
+		{
+			name:    "no key",
+			values:  map[string]string{"MYSVC_DB_PASSWORD": password},
+			wantErr: true,
+		},
+		{
+			name:    "value of another variable",
+			key:     keyStr,
+			values:  map[string]string{"MYSVC_API_KEY": password},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("MYSVC_SECRETS_KEY", tt.key)
+			defer os.Unsetenv("MYSVC_SECRETS_KEY")
+
+			s := &service{envPrefix: "MYSVC_"}
+			err := s.decryptEnvValues(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decryptEnvValues() err = %v, want err %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for k, v := range tt.want {
+				if tt.values[k] != v {
+					t.Errorf("%s = %q, want %q", k, tt.values[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, oldKey := secretsTestKey(t)
+	_, newKey := secretsTestKey(t)
+	v, err := envcrypt.Encrypt(oldKey, "DB_PASSWORD", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, ".env")
+	content := "DB_PASSWORD=" + v + "\n"
+	writeFile(t, file, content)
+
+	// a failed rotation leaves the file untouched
+	if err := rotateFile(file, newKey, oldKey); err == nil {
+		t.Fatal("rotateFile() by a wrong key err = nil")
+	}
+	if data, _ := ioutil.ReadFile(file); string(data) != content {
+		t.Errorf("file changed by a failed rotation: %q", data)
+	}
+
+	if err := rotateFile(file, oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := strings.TrimSuffix(strings.TrimPrefix(string(data), "DB_PASSWORD="), "\n")
+	if got, err := envcrypt.Decrypt(newKey, "DB_PASSWORD", rotated); err != nil || got != "pass" {
+		t.Errorf("Decrypt() by new key = %q, %v", got, err)
+	}
+
+	st, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", st.Mode().Perm())
+	}
+	// no temp file is left
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("files in dir = %d, want 1", len(files))
+	}
+}
@@ -3,22 +3,31 @@
 package goservice
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/baozhenglab/go-sdk/v2/util"
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/baozhenglab/go-sdk/v2/errreport"
 	"github.com/baozhenglab/go-sdk/v2/httpserver"
+	"github.com/baozhenglab/go-sdk/v2/httpserver/binding"
 	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/baozhenglab/go-sdk/v2/metrics"
+	"github.com/baozhenglab/go-sdk/v2/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/joho/godotenv"
-	"github.com/olekukonko/tablewriter"
+	"gopkg.in/go-playground/validator.v9"
 )
 
 const (
@@ -40,9 +49,49 @@ type service struct {
 	logger            logger.Logger
 	hasHttp           bool
 	httpServer        HttpServer
+	namedServers      []namedServer
+	httpServers       map[string]HttpServer
+	tracing           tracingProvider
+	metrics           metricsProvider
+	errReport         errorReporter
 	signalChan        chan os.Signal
 	cmdLine           *AppFlagSet
 	stopFunc          func()
+	envPrefix         string
+	envFiles          []string
+	processEnv        map[string]bool
+	dynamicFlags      map[string]bool
+	envDefaults       map[string]map[string]string
+	devOnlyFlags      map[string]string
+	allowDevFeatures  bool
+	configMu          sync.RWMutex
+	configValues      map[string]string
+	configHandlers    map[string][]ConfigChangeHandler
+	// SIGHUP and reload endpoints reload one at a time
+	reloadMu sync.Mutex
+}
+
+// namedServer is declared by WithHTTPServer and created along with the default server
+type namedServer struct {
+	name   string
+	port   int
+	config *fiber.Config
+}
+
+type metricsProvider interface {
+	Runnable
+	Registry() *prometheus.Registry
+}
+
+type errorReporter interface {
+	Runnable
+	SetResource(name, version, env string)
+}
+
+type tracingProvider interface {
+	Runnable
+	SetResource(name, version, env string)
+	Tracer(name string) trace.Tracer
 }
 
 func New(opts ...Option) Service {
@@ -53,6 +102,15 @@ func New(opts ...Option) Service {
 		initServices:      map[string]PrefixRunnable{},
 		configureServices: map[string]PrefixConfigure{},
 		hasHttp:           true,
+		httpServers:       map[string]HttpServer{},
+		dynamicFlags:      map[string]bool{},
+		envDefaults:       map[string]map[string]string{},
+		devOnlyFlags:      map[string]string{},
+		configHandlers:    map[string][]ConfigChangeHandler{},
+	}
+
+	for name, safe := range defaultDevOnlyFlags {
+		sv.devOnlyFlags[name] = safe
 	}
 
 	for _, opt := range opts {
@@ -72,6 +130,7 @@ func (s *service) Version() string {
 func (s *service) Init() error {
 	for _, dbSv := range s.initServices {
 		if err := dbSv.Run(); err != nil {
+			reportFailure(dbSv, err)
 			return err
 		}
 	}
@@ -93,14 +152,35 @@ func (s *service) Create(fiberConfig *fiber.Config) Service {
 	logger.InitServLogger(false)
 	s.logger = logger.GetCurrent().GetLogger("service")
 
+	// env files are not loaded, they may have values the key can't decrypt yet
+	if len(os.Args) > 1 && os.Args[1] == secretsCommand {
+		os.Exit(s.runSecretsCommand(os.Args[2:]))
+	}
+
 	if s.hasHttp {
 		//// Http server
 		httpServer := httpserver.New(s.name, fiberConfig)
+		httpServer.SetVersion(s.version)
+		httpServer.SetReloader(s.Reload)
 		s.httpServer = httpServer
 
 		s.subServices = append(s.subServices, httpServer)
 	}
 
+	for _, ns := range s.namedServers {
+		httpServer := httpserver.NewNamed(s.name, ns.name, ns.port, ns.config)
+		httpServer.SetVersion(s.version)
+		httpServer.SetReloader(s.Reload)
+		s.httpServers[ns.name] = httpServer
+
+		s.subServices = append(s.subServices, httpServer)
+	}
+
+	s.tracing = tracing.New()
+	s.metrics = metrics.New()
+	s.errReport = errreport.New()
+	s.subServices = append(s.subServices, s.tracing, s.metrics, s.errReport, newConfigWatcher(s))
+
 	s.initFlags()
 
 	if s.name == "" {
@@ -111,10 +191,35 @@ func (s *service) Create(fiberConfig *fiber.Config) Service {
 
 	loggerRunnable := logger.GetCurrent().(Runnable)
 	loggerRunnable.InitFlags()
-	_ = loggerRunnable.Configure()
 
-	s.cmdLine = newFlagSet(s.name, flag.CommandLine)
+	if lv, ok := logger.GetCurrent().(interface{ SetLevel(string) error }); ok {
+		s.OnConfigChange("log-level", func(_, _, newValue string) {
+			if err := lv.SetLevel(newValue); err != nil {
+				s.logger.Errorln("changing log level:", err)
+			}
+		})
+	}
+
+	s.cmdLine = newFlagSet(s.name, flag.CommandLine, s.envPrefix)
 	s.parseFlags()
+	s.applyEnvProfile()
+
+	// configure logger after flags are parsed, so log-level is applied
+	_ = loggerRunnable.Configure()
+	s.snapshotConfig()
+	s.logConfig()
+
+	s.tracing.SetResource(s.name, s.version, s.env)
+	if err := s.tracing.Configure(); err != nil {
+		s.logger.Fatalf("Configuring tracing: %s", err.Error())
+	}
+	if err := s.metrics.Configure(); err != nil {
+		s.logger.Fatalf("Configuring metrics: %s", err.Error())
+	}
+	s.errReport.SetResource(s.name, s.version, s.env)
+	if err := s.errReport.Configure(); err != nil {
+		s.logger.Fatalf("Configuring error report: %s", err.Error())
+	}
 
 	return s
 }
@@ -137,7 +242,9 @@ func (s *service) Start() error {
 			s.logger.Infoln(sig)
 			switch sig {
 			case syscall.SIGHUP:
-				return nil
+				if err := s.Reload(); err != nil {
+					s.logger.Errorln("reloading:", err)
+				}
 			default:
 				s.Stop()
 				return nil
@@ -148,6 +255,8 @@ func (s *service) Start() error {
 
 func (s *service) initFlags() {
 	flag.StringVar(&s.env, "app-env", DevEnv, "Env for service. Ex: dev | stg | prd")
+	flag.BoolVar(&s.allowDevFeatures, "app-allow-dev-features", false,
+		"Allow dev-only features (pprof, route table, verbose errors, trace log, fiber debug mode) in prd")
 
 	for _, subService := range s.subServices {
 		subService.InitFlags()
@@ -168,27 +277,51 @@ func (s *service) run() <-chan error {
 
 	// Start all services
 	for _, subService := range s.subServices {
-		go func(subSv Runnable) { c <- subSv.Run() }(subService)
+		go func(subSv Runnable) {
+			err := subSv.Run()
+			if err != nil {
+				reportFailure(subSv, err)
+			}
+			c <- err
+		}(subService)
 	}
 
 	return c
 }
 
-// Stop service and stop its components at the same time
+// reportFailure sends the error of a failed component to the error reporter
+func reportFailure(r Runnable, err error) {
+	errreport.Capture(context.Background(), err, &errreport.Report{
+		Level: errreport.LevelFatal,
+		Tags:  map[string]string{"component": r.Name()},
+	})
+}
+
+// Stop service and stop its components at the same time. Error reports are
+// stopped last, so errors of requests drained by HTTP servers are reported
 func (s *service) Stop() {
 	s.logger.Infoln("Stopping service...")
 	stopChan := make(chan bool)
+	stopping := 0
 	for _, subService := range s.subServices {
+		if s.errReport != nil && subService == Runnable(s.errReport) {
+			continue
+		}
+		stopping++
 		go func(subSv Runnable) { stopChan <- <-subSv.Stop() }(subService)
 	}
 
 	for _, dbSv := range s.initServices {
+		stopping++
 		go func(subSv Runnable) { stopChan <- <-subSv.Stop() }(dbSv)
 	}
 
-	for i := 0; i < len(s.subServices)+len(s.initServices); i++ {
+	for i := 0; i < stopping; i++ {
 		<-stopChan
 	}
+	if s.errReport != nil {
+		<-s.errReport.Stop()
+	}
 
 	//s.stopFunc()
 	s.logger.Infoln("service stopped")
@@ -202,50 +335,181 @@ func (s *service) HTTPServer() HttpServer {
 	return s.httpServer
 }
 
+// flagConfigured is an HTTP server which takes new values of its flags
+type flagConfigured interface {
+	ConfigWithFlags(values map[string]string) (httpserver.Config, error)
+}
+
+// Reload reads env files again to apply dynamic flags, then reloads HTTP
+// servers without dropping connections. Flags of HTTP servers (ex: fiberPort,
+// fiber-tls-cert) change only when they are declared by WithDynamicFlags
+func (s *service) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if err := s.reloadConfig(); err != nil {
+		return err
+	}
+	values := s.dynamicConfig()
+
+	servers := make([]HttpServer, 0, len(s.httpServers)+1)
+	if s.httpServer != nil {
+		servers = append(servers, s.httpServer)
+	}
+	for _, ns := range s.namedServers {
+		servers = append(servers, s.httpServers[ns.name])
+	}
+
+	for _, srv := range servers {
+		config := srv.GetConfig()
+		if fc, ok := srv.(flagConfigured); ok {
+			var err error
+			if config, err = fc.ConfigWithFlags(values); err != nil {
+				return fmt.Errorf("reloading %s: %w", srv.Name(), err)
+			}
+		}
+		if err := srv.Reload(config); err != nil {
+			return fmt.Errorf("reloading %s: %w", srv.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (s *service) NamedHTTPServer(name string) HttpServer {
+	if name == httpserver.DefaultServer {
+		return s.httpServer
+	}
+	return s.httpServers[name]
+}
+
 func (s *service) Logger(prefix string) logger.Logger {
 	return logger.GetCurrent().GetLogger(prefix)
 }
 
+func (s *service) Tracer(name string) trace.Tracer {
+	return s.tracing.Tracer(name)
+}
+
+func (s *service) Metrics() *prometheus.Registry {
+	return s.metrics.Registry()
+}
+
 func (s *service) OutEnv() {
 	s.cmdLine.GetSampleEnvs()
 }
 
-func (s *service) RouteTable() {
-	routes := s.HTTPServer().Routes()
-	data := make([][]string, 0)
-	for _, route := range routes {
-		for _, ro := range route {
-			r := []string{ro.Path, ro.Method, GetListNameHandler(ro.Handlers)}
-			data = append(data, r)
-		}
+// logConfig prints values of all flags at debug level, sensitive ones are masked
+func (s *service) logConfig() {
+	values := s.cmdLine.Values()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n  %s=%s", name, values[name])
 	}
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetRowLine(true)
-	table.SetHeader([]string{"Path", "Method", "Handler"})
-	table.AppendBulk(data) // Add Bulk Data
-	table.Render()
+	s.logger.Debugf("config of %s:%s", s.env, b.String())
 }
 
-func (s *service) parseFlags() {
-	envFile := os.Getenv("ENV_FILE")
+// RouteTable writes routes to stdout as table (default), json or csv.
+// Routes are read without starting or changing the http server
+func (s *service) RouteTable(format ...string) error {
+	f := httpserver.RouteFormatTable
+	if len(format) > 0 {
+		f = format[0]
+	}
+
+	routes, err := s.HTTPServer().RouteInfos()
+	if err != nil {
+		return err
+	}
+	return httpserver.WriteRoutes(os.Stdout, routes, f)
+}
+
+// envFileList returns env files from ENV_FILE (or <prefix>ENV_FILE) separated by comma,
+// the later file overrides the former. A file ends with "?" is optional,
+// ex: ENV_FILE=.env,.env.stg,.env.local?
+func (s *service) envFileList() ([]string, map[string]bool) {
+	envFile := os.Getenv(s.cmdLine.EnvName("env-file"))
+	if envFile == "" {
+		envFile = os.Getenv("ENV_FILE")
+	}
 	if envFile == "" {
-		envFile = ".env"
+		return []string{".env"}, map[string]bool{".env": true}
 	}
 
-	_, err := os.Stat(envFile)
-	if err == nil {
-		err := godotenv.Load(envFile)
-		if err != nil {
-			s.logger.Fatalf("Loading env(%s): %s", envFile, err.Error())
+	var files []string
+	optional := map[string]bool{}
+	for _, file := range strings.Split(envFile, ",") {
+		file = strings.TrimSpace(file)
+		if strings.HasSuffix(file, "?") {
+			file = strings.TrimSuffix(file, "?")
+			optional[file] = true
+		}
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, optional
+}
+
+func (s *service) parseFlags() {
+	files, optional := s.envFileList()
+	s.envFiles = files
+
+	// remember what is set by the process env, env files never override them
+	s.processEnv = map[string]bool{}
+	for _, kv := range os.Environ() {
+		s.processEnv[strings.SplitN(kv, "=", 2)[0]] = true
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil && !(os.IsNotExist(err) && optional[file]) {
+			s.logger.Fatalf("Loading env(%s): %s", file, err.Error())
+		}
+	}
+
+	values, err := s.readEnvFiles()
+	if err != nil {
+		s.logger.Fatalf("Loading env: %s", err.Error())
+	}
+
+	for k, v := range values {
+		if !s.processEnv[k] {
+			_ = os.Setenv(k, v)
 		}
-	} else if envFile != ".env" {
-		s.logger.Fatalf("Loading env(%s): %s", envFile, err.Error())
 	}
 
 	s.cmdLine.Parse([]string{})
 }
 
+// readEnvFiles returns variables of env files without touching the process env
+func (s *service) readEnvFiles() (map[string]string, error) {
+	values := map[string]string{}
+	for _, file := range s.envFiles {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+
+		fileValues, err := godotenv.Read(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Error())
+		}
+
+		for k, v := range fileValues {
+			values[k] = v
+		}
+	}
+
+	if err := s.decryptEnvValues(values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
 // Service must have a name for service discovery and logging/monitoring
 func WithName(name string) Option {
 	return func(s *service) { s.name = name }
@@ -263,12 +527,83 @@ func WithFileLogger() Option {
 	}
 }
 
+// Prefix of env variables which flags are read from, ex: "MYSVC_"
+// makes flag "app-env" read from MYSVC_APP_ENV
+func WithEnvPrefix(prefix string) Option {
+	return func(s *service) { s.envPrefix = prefix }
+}
+
+// Mark flags as sensitive, their values will be masked when printing config.
+// Flags named like *secret*, *password*, *-key, *api-key*, *private-key* are sensitive by default
+func WithSensitiveFlags(names ...string) Option {
+	return func(s *service) { MarkFlagSensitive(names...) }
+}
+
+// Declare flags which can be changed at runtime by editing env files,
+// the config watcher must be enabled by -config-watch.
+//
+// Only OnConfigChange subscribers and ConfigValue see new values: variables
+// bound to the flags (flag.XxxVar) keep their startup values, because other
+// goroutines read them without a lock. Components apply changes in a handler, ex:
+//
+//	sc.OnConfigChange("feature-x", func(_, _, v string) { featureX.Store(v == "true") })
+func WithDynamicFlags(names ...string) Option {
+	return func(s *service) {
+		for _, name := range names {
+			s.dynamicFlags[name] = true
+		}
+	}
+}
+
+// Default values of flags for an env, they are used when the flags
+// are not set by command line, env variables or env files.
+// Ex: WithEnvDefaults(PrdEnv, map[string]string{"log-level": "info"})
+func WithEnvDefaults(env string, values map[string]string) Option {
+	return func(s *service) {
+		if s.envDefaults[env] == nil {
+			s.envDefaults[env] = map[string]string{}
+		}
+		for name, value := range values {
+			s.envDefaults[env][name] = value
+		}
+	}
+}
+
+// Declare a dev-only flag of a component with its safe value,
+// the flag is forced to that value in prd unless -app-allow-dev-features is set
+func WithDevOnlyFlag(name, safeValue string) Option {
+	return func(s *service) { s.devOnlyFlags[name] = safeValue }
+}
+
 // Add Runnable component to SDK
 // These components will run parallel in when service run
 func WithRunnable(r Runnable) Option {
 	return func(s *service) { s.subServices = append(s.subServices, r) }
 }
 
+// Declare an HTTP server besides the default one, ex: an internal API or
+// an admin server which is not exposed by the ingress. It has its own flags
+// prefixed by http-<name>- (ex: -http-admin-port), middlewares and handlers,
+// and runs as a separate component. Get it by NamedHTTPServer(name)
+func WithHTTPServer(name string, port int, config *fiber.Config) Option {
+	return func(s *service) {
+		if name == "" || name == httpserver.DefaultServer {
+			log.Fatal(fmt.Sprintf("http server name %q is reserved", name))
+		}
+		for _, ns := range s.namedServers {
+			if ns.name == name {
+				log.Fatal(fmt.Sprintf("http server %s is duplicated", name))
+			}
+		}
+		s.namedServers = append(s.namedServers, namedServer{name: name, port: port, config: config})
+
+		prefix := httpserver.FlagPrefix(name)
+		s.devOnlyFlags[prefix+"-pprof"] = "false"
+		s.devOnlyFlags[prefix+"-route-table"] = "false"
+		s.devOnlyFlags[prefix+"-verbose-errors"] = "false"
+	}
+}
+
 // Add init component to SDK
 // These components will run sequentially before service run
 func WithInitRunnable(r PrefixRunnable) Option {
@@ -294,6 +629,17 @@ func WithInitConfig(r PrefixConfigure) Option {
 	}
 }
 
+// Add a validation rule used by binding.Bind, message is its error:
+// {0} is the field, {1} is the param of the rule.
+// Ex: WithValidation("phone", isPhone, "{0} is not a phone number")
+func WithValidation(tag string, fn validator.Func, message string) Option {
+	return func(s *service) {
+		if err := binding.RegisterValidation(tag, fn, message); err != nil {
+			log.Fatal(fmt.Sprintf("registering validation %s: %v", tag, err))
+		}
+	}
+}
+
 func (s *service) Get(prefix string) (interface{}, bool) {
 	is, ok := s.initServices[prefix]
 
@@ -0,0 +1,182 @@
+package goservice
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/httpserver"
+	"github.com/baozhenglab/go-sdk/v2/logger"
+)
+
+func TestEnvFileList(t *testing.T) {
+	tests := []struct {
+		envFile      string
+		wantFiles    []string
+		wantOptional map[string]bool
+	}{
+		{"", []string{".env"}, map[string]bool{".env": true}},
+		{".env.stg", []string{".env.stg"}, map[string]bool{}},
+		{".env, .env.stg,.env.local?", []string{".env", ".env.stg", ".env.local"}, map[string]bool{".env.local": true}},
+		{".env,,", []string{".env"}, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.envFile, func(t *testing.T) {
+			os.Setenv("MYSVC_ENV_FILE", tt.envFile)
+			defer os.Unsetenv("MYSVC_ENV_FILE")
+
+			s := &service{cmdLine: newFlagSet("test", flag.NewFlagSet("test", flag.ContinueOnError), "MYSVC_")}
+			files, optional := s.envFileList()
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("files = %v, want %v", files, tt.wantFiles)
+			}
+			if !reflect.DeepEqual(optional, tt.wantOptional) {
+				t.Errorf("optional = %v, want %v", optional, tt.wantOptional)
+			}
+		})
+	}
+}
+
+func TestParseFlagsPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base, override := filepath.Join(dir, ".env"), filepath.Join(dir, ".env.stg")
+	writeFile(t, base, "MYSVC_A=base\nMYSVC_B=base\nMYSVC_C=base\n")
+	writeFile(t, override, "MYSVC_B=stg\nMYSVC_C=stg\n")
+
+	os.Setenv("MYSVC_ENV_FILE", base+","+override+","+filepath.Join(dir, "missing")+"?")
+	os.Setenv("MYSVC_C", "process")
+	defer func() {
+		for _, name := range []string{"MYSVC_ENV_FILE", "MYSVC_A", "MYSVC_B", "MYSVC_C", "MYSVC_D"} {
+			os.Unsetenv(name)
+		}
+	}()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a, b, c, d := fs.String("a", "", ""), fs.String("b", "", ""), fs.String("c", "", ""), fs.String("d", "default", "")
+	s := newTestService(t, fs, "")
+	s.cmdLine = newFlagSet("test", fs, "MYSVC_")
+	s.parseFlags()
+
+	tests := []struct {
+		flag, got, want string
+	}{
+		{"a", *a, "base"},
+		// later files override former ones
+		{"b", *b, "stg"},
+		// the process env wins over files
+		{"c", *c, "process"},
+		{"d", *d, "default"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("flag %s = %q, want %q", tt.flag, tt.got, tt.want)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		prefix, flag, want string
+	}{
+		{"", "app-env", "APP_ENV"},
+		{"MYSVC_", "app-env", "MYSVC_APP_ENV"},
+		{"MYSVC_", "db.main-dsn", "MYSVC_DB_MAIN_DSN"},
+	}
+	for _, tt := range tests {
+		fs := newFlagSet("test", flag.NewFlagSet("test", flag.ContinueOnError), tt.prefix)
+		if got := fs.EnvName(tt.flag); got != tt.want {
+			t.Errorf("EnvName(%q) with prefix %q = %q, want %q", tt.flag, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestWithHTTPServer(t *testing.T) {
+	s := New(WithName("test"), WithHTTPServer("admin", 9000, nil), WithHTTPServer("internal", 9001, nil)).(*service)
+
+	if len(s.namedServers) != 2 || s.namedServers[0].name != "admin" || s.namedServers[1].port != 9001 {
+		t.Fatalf("named servers = %+v", s.namedServers)
+	}
+	// dev features of named servers are guarded like the default server
+	for _, name := range []string{"http-admin-pprof", "http-internal-route-table", "http-admin-verbose-errors"} {
+		if s.devOnlyFlags[name] != "false" {
+			t.Errorf("%s is not a dev only flag", name)
+		}
+	}
+
+	s.httpServer = httpserver.New("test", nil)
+	s.httpServers["admin"] = httpserver.NewNamed("test", "admin", 9000, nil)
+	tests := []struct {
+		name   string
+		server string
+	}{
+		{httpserver.DefaultServer, httpserver.DefaultServer},
+		{"admin", "admin"},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		srv := s.NamedHTTPServer(tt.name)
+		if tt.server == "" {
+			if srv != nil {
+				t.Errorf("NamedHTTPServer(%s) = %v, want nil", tt.name, srv)
+			}
+			continue
+		}
+		if srv == nil || srv.ServerName() != tt.server {
+			t.Errorf("NamedHTTPServer(%s) = %v, want server %s", tt.name, srv, tt.server)
+		}
+	}
+}
+
+// stopRecorder is a component which records when it is stopped
+type stopRecorder struct {
+	name    string
+	delay   time.Duration
+	mu      *sync.Mutex
+	stopped *[]string
+}
+
+func (r *stopRecorder) Name() string                          { return r.name }
+func (r *stopRecorder) InitFlags()                            {}
+func (r *stopRecorder) Configure() error                      { return nil }
+func (r *stopRecorder) Run() error                            { return nil }
+func (r *stopRecorder) SetResource(name, version, env string) {}
+
+func (r *stopRecorder) Stop() <-chan bool {
+	c := make(chan bool)
+	go func() {
+		time.Sleep(r.delay)
+		r.mu.Lock()
+		*r.stopped = append(*r.stopped, r.name)
+		r.mu.Unlock()
+		c <- true
+	}()
+	return c
+}
+
+func TestStopReportsErrorsLast(t *testing.T) {
+	logger.InitServLogger(false)
+	var mu sync.Mutex
+	var stopped []string
+	errReport := &stopRecorder{name: "error-report", mu: &mu, stopped: &stopped}
+	s := &service{
+		logger:       logger.GetCurrent().GetLogger("service"),
+		errReport:    errReport,
+		subServices:  []Runnable{errReport, &stopRecorder{name: "http", delay: 20 * time.Millisecond, mu: &mu, stopped: &stopped}},
+		initServices: map[string]PrefixRunnable{},
+	}
+
+	s.Stop()
+	if !reflect.DeepEqual(stopped, []string{"http", "error-report"}) {
+		t.Errorf("stopped %v, want error reports after the HTTP server", stopped)
+	}
+}
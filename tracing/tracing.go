@@ -0,0 +1,215 @@
+// OpenTelemetry tracing provider
+//
+// The provider is registered globally (otel.SetTracerProvider), so
+// the http server middleware and other components pick it up without
+// holding a reference to this service.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterStdout   = "stdout"
+	ExporterFile     = "file"
+)
+
+var enabled int32
+
+// IsEnabled reports whether a tracing provider is configured
+func IsEnabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+type Config struct {
+	Enabled     bool    `json:"tracing_enabled"`
+	Exporter    string  `json:"tracing_exporter"`
+	Endpoint    string  `json:"tracing_endpoint"`
+	Insecure    bool    `json:"tracing_insecure"`
+	File        string  `json:"tracing_file"`
+	SampleRatio float64 `json:"tracing_sample_ratio"`
+	Propagators string  `json:"tracing_propagators"`
+}
+
+type tracingService struct {
+	Config
+	name     string
+	version  string
+	env      string
+	logger   logger.Logger
+	provider *sdktrace.TracerProvider
+	out      io.Closer
+}
+
+func New() *tracingService {
+	return &tracingService{}
+}
+
+func (ts *tracingService) Name() string { return "tracing" }
+
+// SetResource sets attributes of the service which are attached to all spans,
+// they are known after flags are parsed
+func (ts *tracingService) SetResource(name, version, env string) {
+	ts.name, ts.version, ts.env = name, version, env
+}
+
+func (ts *tracingService) InitFlags() {
+	prefix := "tracing-"
+	flag.BoolVar(&ts.Enabled, prefix+"enabled", false, "Enable OpenTelemetry tracing")
+	flag.StringVar(&ts.Exporter, prefix+"exporter", ExporterOTLPHTTP, "Span exporter: otlp-http | otlp-grpc | stdout | file")
+	flag.StringVar(&ts.Endpoint, prefix+"endpoint", "",
+		"OTLP endpoint (host:port). Default from OTEL_EXPORTER_OTLP_ENDPOINT or localhost")
+	flag.BoolVar(&ts.Insecure, prefix+"insecure", false, "Connect to the OTLP endpoint without TLS")
+	flag.StringVar(&ts.File, prefix+"file", "", "File to write spans to, used by the file exporter")
+	flag.Float64Var(&ts.SampleRatio, prefix+"sample-ratio", 1, "Ratio of new traces to be sampled, from 0 to 1")
+	flag.StringVar(&ts.Propagators, prefix+"propagators", "tracecontext,baggage,b3",
+		"Propagators of trace headers: tracecontext | baggage | b3 | b3multi")
+}
+
+func (ts *tracingService) Configure() error {
+	ts.logger = logger.GetCurrent().GetLogger("tracing")
+
+	propagators, err := parsePropagators(ts.Propagators)
+	if err != nil {
+		return err
+	}
+	otel.SetTextMapPropagator(propagators)
+
+	if !ts.Enabled {
+		return nil
+	}
+
+	exporter, err := ts.newExporter()
+	if err != nil {
+		return err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(ts.name),
+		semconv.ServiceVersion(ts.version),
+		semconv.DeploymentEnvironment(ts.env),
+	))
+	if err != nil {
+		return err
+	}
+
+	ts.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ts.SampleRatio))),
+	)
+	otel.SetTracerProvider(ts.provider)
+	atomic.StoreInt32(&enabled, 1)
+
+	ts.logger.Infof("tracing is enabled, exporter: %s", ts.Exporter)
+	return nil
+}
+
+func (ts *tracingService) newExporter() (sdktrace.SpanExporter, error) {
+	ctx := context.Background()
+
+	switch ts.Exporter {
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{}
+		if ts.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(ts.Endpoint))
+		}
+		if ts.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case ExporterOTLPGRPC:
+		opts := []otlptracegrpc.Option{}
+		if ts.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(ts.Endpoint))
+		}
+		if ts.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if ts.File == "" {
+			return nil, errors.New("tracing-file is required by the file exporter")
+		}
+		f, err := os.OpenFile(ts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		ts.out = f
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	}
+	return nil, fmt.Errorf("unsupported tracing exporter %q", ts.Exporter)
+}
+
+func parsePropagators(s string) (propagation.TextMapPropagator, error) {
+	var props []propagation.TextMapPropagator
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "tracecontext":
+			props = append(props, propagation.TraceContext{})
+		case "baggage":
+			props = append(props, propagation.Baggage{})
+		case "b3":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		default:
+			return nil, fmt.Errorf("unsupported tracing propagator %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(props...), nil
+}
+
+// Run does nothing, the provider is configured by the service before
+// other components start, so their first spans are not lost
+func (ts *tracingService) Run() error { return nil }
+
+// Stop flushes pending spans
+func (ts *tracingService) Stop() <-chan bool {
+	c := make(chan bool)
+	go func() {
+		if ts.provider != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := ts.provider.Shutdown(ctx); err != nil {
+				ts.logger.Errorln("flushing spans:", err)
+			}
+			cancel()
+		}
+		if ts.out != nil {
+			_ = ts.out.Close()
+		}
+		c <- true
+	}()
+	return c
+}
+
+// Tracer returns a tracer of the global provider, it's a no-op tracer
+// when tracing is disabled
+func (ts *tracingService) Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"go.opentelemetry.io/otel"
+)
+
+func TestParsePropagators(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantFields []string
+		wantErr    bool
+	}{
+		{"tracecontext,baggage,b3", []string{"b3", "baggage", "traceparent", "tracestate"}, false},
+		{" tracecontext , b3multi ", []string{"traceparent", "tracestate", "x-b3-flags", "x-b3-sampled", "x-b3-spanid", "x-b3-traceid"}, false},
+		{"baggage,", []string{"baggage"}, false},
+		{"", nil, false},
+		{"tracecontext,jaeger", nil, true},
+	}
+	for _, tt := range tests {
+		props, err := parsePropagators(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePropagators(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		fields := props.Fields()
+		for i := range fields {
+			fields[i] = strings.ToLower(fields[i])
+		}
+		sort.Strings(fields)
+		if len(fields) == 0 {
+			fields = nil
+		}
+		if !reflect.DeepEqual(fields, tt.wantFields) {
+			t.Errorf("parsePropagators(%q) fields = %v, want %v", tt.value, fields, tt.wantFields)
+		}
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		exporter string
+		file     string
+		wantErr  bool
+	}{
+		{ExporterOTLPHTTP, "", false},
+		{ExporterOTLPGRPC, "", false},
+		{ExporterStdout, "", false},
+		{ExporterFile, filepath.Join(dir, "spans.json"), false},
+		{ExporterFile, "", true},
+		{ExporterFile, filepath.Join(dir, "missing", "spans.json"), true},
+		{"jaeger", "", true},
+	}
+	for _, tt := range tests {
+		ts := New()
+		ts.Exporter, ts.File, ts.Endpoint, ts.Insecure = tt.exporter, tt.file, "localhost:4318", true
+
+		exporter, err := ts.newExporter()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("exporter %s with file %q: error = %v, want error %v", tt.exporter, tt.file, err, tt.wantErr)
+		}
+		if exporter != nil {
+			_ = exporter.Shutdown(context.Background())
+		}
+		if ts.out != nil {
+			_ = ts.out.Close()
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	logger.InitServLogger(false)
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+		atomic.StoreInt32(&enabled, 0)
+	}()
+
+	tests := []struct {
+		name        string
+		enabled     bool
+		exporter    string
+		propagators string
+		sampleRatio float64
+		wantErr     bool
+		wantSampled bool
+	}{
+		{name: "disabled", exporter: ExporterFile, propagators: "tracecontext"},
+		{name: "sampled", enabled: true, exporter: ExporterFile, propagators: "tracecontext", sampleRatio: 1, wantSampled: true},
+		{name: "not sampled", enabled: true, exporter: ExporterFile, propagators: "tracecontext", sampleRatio: 0},
+		{name: "unknown exporter", enabled: true, exporter: "zipkin", propagators: "tracecontext", wantErr: true},
+		{name: "unknown propagator", exporter: ExporterFile, propagators: "xray", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&enabled, 0)
+			ts := New()
+			ts.Enabled, ts.Exporter, ts.Propagators, ts.SampleRatio = tt.enabled, tt.exporter, tt.propagators, tt.sampleRatio
+			ts.File = filepath.Join(dir, "spans.json")
+			ts.SetResource("test", "1.0.0", "dev")
+			defer func() { <-ts.Stop() }()
+
+			err := ts.Configure()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Configure() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if IsEnabled() != tt.enabled {
+				t.Errorf("IsEnabled() = %v, want %v", IsEnabled(), tt.enabled)
+			}
+			if !tt.enabled {
+				return
+			}
+
+			_, span := ts.Tracer("test").Start(context.Background(), "op")
+			span.End()
+			if got := span.SpanContext().IsSampled(); got != tt.wantSampled {
+				t.Errorf("sampled = %v, want %v", got, tt.wantSampled)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Encrypt values of env files, so they can be committed to Git.
+//
+// An encrypted value looks like ENC[base64(nonce|ciphertext)],
+// it is sealed by AES-256-GCM with a 32 bytes key. The name of its variable
+// is authenticated as additional data, so a value cannot be moved to another
+// variable (ex: a password pasted as a key of another service).
+package envcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	KeySize = 32
+	prefix  = "ENC["
+	suffix  = "]"
+)
+
+var (
+	ErrInvalidKey   = errors.New("key must be 32 bytes, encoded in base64 or hex")
+	ErrInvalidValue = errors.New("encrypted value is malformed")
+
+	encryptedRegexp = regexp.MustCompile(`ENC\[[A-Za-z0-9+/=]*\]`)
+	// NAME=ENC[...] lines of env files, values may be quoted or exported
+	assignmentRegexp = regexp.MustCompile(`(?m)^(\s*(?:export\s+)?)([A-Za-z_][A-Za-z0-9_.]*)(\s*[=:]\s*["']?)(ENC\[[A-Za-z0-9+/=]*\])`)
+)
+
+// ParseKey decodes a key in base64 or hex format
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// GenerateKey returns a new random key in base64 format
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func IsEncrypted(v string) bool {
+	return strings.HasPrefix(v, prefix) && strings.HasSuffix(v, suffix)
+}
+
+// Encrypt seals the value of the variable name
+func Encrypt(key []byte, name, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), []byte(name))
+	return prefix + base64.StdEncoding.EncodeToString(sealed) + suffix, nil
+}
+
+// Decrypt returns the plain value of the variable name,
+// values which are not encrypted are returned as is
+func Decrypt(key []byte, name, v string) (string, error) {
+	if !IsEncrypted(v) {
+		return v, nil
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(v, prefix), suffix))
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", ErrInvalidValue
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", errors.New("cannot decrypt value, key is wrong, value is corrupted or encrypted for another variable")
+	}
+	return string(plain), nil
+}
+
+// Rotate re-encrypts all encrypted values in content of an env file
+// with the new key, everything else is kept as is
+func Rotate(oldKey, newKey []byte, content []byte) ([]byte, int, error) {
+	var (
+		count int
+		err   error
+	)
+
+	res := assignmentRegexp.ReplaceAllFunc(content, func(line []byte) []byte {
+		if err != nil {
+			return line
+		}
+
+		m := assignmentRegexp.FindSubmatch(line)
+		name, v := string(m[2]), string(m[4])
+
+		var plain, encrypted string
+		if plain, err = Decrypt(oldKey, name, v); err != nil {
+			err = fmt.Errorf("%s: %v", name, err)
+			return line
+		}
+		if encrypted, err = Encrypt(newKey, name, plain); err != nil {
+			return line
+		}
+
+		count++
+		return []byte(string(m[1]) + name + string(m[3]) + encrypted)
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+	// values which are not assigned to a variable cannot be decrypted
+	if total := len(encryptedRegexp.FindAll(content, -1)); total != count {
+		return nil, 0, fmt.Errorf("%d encrypted value(s) are not assigned to a variable", total-count)
+	}
+	return res, count, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,158 @@
+package envcrypt
+
+import (
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	s, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{strings.Repeat("ab", 32), false},
+		{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", false},
+		{" MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n", false},
+		{"short", true},
+		{strings.Repeat("ab", 16), true},
+	}
+	for _, tt := range tests {
+		if _, err := ParseKey(tt.key); (err != nil) != tt.wantErr {
+			t.Errorf("ParseKey(%q) err = %v, want err %v", tt.key, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	key, otherKey := testKey(t), testKey(t)
+	encrypted, err := Encrypt(key, "DB_PASSWORD", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) {
+		t.Fatalf("IsEncrypted(%q) = false", encrypted)
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		varName string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"encrypted", key, "DB_PASSWORD", encrypted, "s3cr3t", false},
+		{"plain value as is", key, "DB_PASSWORD", "plain", "plain", false},
+		{"wrong key", otherKey, "DB_PASSWORD", encrypted, "", true},
+		{"moved to another variable", key, "API_KEY", encrypted, "", true},
+		{"malformed", key, "DB_PASSWORD", "ENC[!!]", "", true},
+		{"too short", key, "DB_PASSWORD", "ENC[AAAA]", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.key, tt.varName, tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Decrypt() = %q, %v, want %q, err %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	enc := func(name, plain string) string {
+		v, err := Encrypt(oldKey, name, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	content := "# comment\n" +
+		"PLAIN=value\n" +
+		"DB_PASSWORD=" + enc("DB_PASSWORD", "pass") + "\n" +
+		"export API_KEY=\"" + enc("API_KEY", "key") + "\"\n" +
+		"JWT_SECRET: " + enc("JWT_SECRET", "jwt") + "\n"
+
+	res, count, err := Rotate(oldKey, newKey, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+
+	lines := strings.Split(string(res), "\n")
+	if lines[0] != "# comment" || lines[1] != "PLAIN=value" {
+		t.Errorf("other lines changed: %q", lines[:2])
+	}
+	tests := []struct {
+		line            int
+		name, prefix    string
+		trim, wantPlain string
+	}{
+		{2, "DB_PASSWORD", "DB_PASSWORD=", "", "pass"},
+		{3, "API_KEY", "export API_KEY=\"", "\"", "key"},
+		{4, "JWT_SECRET", "JWT_SECRET: ", "", "jwt"},
+	}
+	for _, tt := range tests {
+		line := lines[tt.line]
+		if !strings.HasPrefix(line, tt.prefix) {
+			t.Errorf("line %q, want prefix %q", line, tt.prefix)
+			continue
+		}
+		v := strings.TrimSuffix(strings.TrimPrefix(line, tt.prefix), tt.trim)
+		if got, err := Decrypt(newKey, tt.name, v); err != nil || got != tt.wantPlain {
+			t.Errorf("Decrypt(%s) by new key = %q, %v, want %q", tt.name, got, err, tt.wantPlain)
+		}
+		if _, err := Decrypt(oldKey, tt.name, v); err == nil {
+			t.Errorf("%s is still decrypted by the old key", tt.name)
+		}
+	}
+}
+
+func TestRotateErrors(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	v, err := Encrypt(oldKey, "A", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"wrong variable", "B=" + v + "\n"},
+		{"wrong key", "A=" + v + "\n" + "C=" + mustEncrypt(t, newKey, "C") + "\n"},
+		{"not assigned", "# old value " + v + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Rotate(oldKey, newKey, []byte(tt.content)); err == nil {
+				t.Error("Rotate() err = nil")
+			}
+		})
+	}
+}
+
+func mustEncrypt(t *testing.T, key []byte, name string) string {
+	t.Helper()
+	v, err := Encrypt(key, name, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,189 @@
+// Watch files and call back when their content changed.
+//
+// Watcher uses inotify (via fsnotify) on the parent directories, so it
+// also works with atomic renames and symlink swaps (ex: k8s ConfigMap).
+// If inotify is not available, it falls back to polling.
+package filewatch
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultDebounce     = 200 * time.Millisecond
+)
+
+var ErrNoFiles = errors.New("no file to watch")
+
+// Watcher watches files, create it by New
+type Watcher struct {
+	files     []string
+	interval  time.Duration
+	debounce  time.Duration
+	forcePoll bool
+	logger    logger.Logger
+	hashes    map[string][sha256.Size]byte
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+}
+
+type Opt func(*Watcher)
+
+// Interval of polling, it's used when inotify is not available or forced
+func WithPollInterval(d time.Duration) Opt {
+	return func(w *Watcher) {
+		if d > 0 {
+			w.interval = d
+		}
+	}
+}
+
+// Always poll files instead of using inotify, ex: on network file systems
+func WithForcePoll(force bool) Opt {
+	return func(w *Watcher) { w.forcePoll = force }
+}
+
+func WithLogger(l logger.Logger) Opt {
+	return func(w *Watcher) { w.logger = l }
+}
+
+func New(files []string, opts ...Opt) *Watcher {
+	w := &Watcher{
+		interval: defaultPollInterval,
+		debounce: defaultDebounce,
+		hashes:   map[string][sha256.Size]byte{},
+		stopChan: make(chan struct{}),
+	}
+
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			f = abs
+		}
+		w.files = append(w.files, f)
+	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	if w.logger == nil {
+		w.logger = logger.GetCurrent().GetLogger("filewatch")
+	}
+
+	return w
+}
+
+// Watch blocks until Stop is called, onChange is called with the list
+// of files which have content changed (or have been created/removed)
+func (w *Watcher) Watch(onChange func(files []string)) error {
+	if len(w.files) == 0 {
+		return ErrNoFiles
+	}
+
+	// remember current content, so only real changes are reported
+	w.changedFiles()
+
+	if w.forcePoll {
+		return w.poll(onChange)
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.logger.Warnf("inotify is not available (%s), fallback to polling", err.Error())
+		return w.poll(onChange)
+	}
+	defer fw.Close()
+
+	dirs := map[string]bool{}
+	for _, f := range w.files {
+		dirs[filepath.Dir(f)] = true
+	}
+
+	for dir := range dirs {
+		if err := fw.Add(dir); err != nil {
+			w.logger.Warnf("cannot watch %s (%s), fallback to polling", dir, err.Error())
+			return w.poll(onChange)
+		}
+	}
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-w.stopChan:
+			return nil
+		case _, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			// editors and k8s write files in many steps, wait for them to settle
+			timer = time.After(w.debounce)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Warnln("watching files:", err)
+		case <-timer:
+			timer = nil
+			if changed := w.changedFiles(); len(changed) > 0 {
+				onChange(changed)
+			}
+		}
+	}
+}
+
+func (w *Watcher) poll(onChange func(files []string)) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			return nil
+		case <-ticker.C:
+			if changed := w.changedFiles(); len(changed) > 0 {
+				onChange(changed)
+			}
+		}
+	}
+}
+
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stopChan) })
+}
+
+// changedFiles compares content of files with the last known one.
+// Comparing content (not mod time) avoids false events on touch and
+// works with symlinks which are swapped
+func (w *Watcher) changedFiles() []string {
+	var changed []string
+
+	for _, f := range w.files {
+		var sum [sha256.Size]byte
+		data, err := ioutil.ReadFile(f)
+		if err == nil {
+			sum = sha256.Sum256(data)
+		} else if !os.IsNotExist(err) {
+			w.logger.Warnf("reading %s: %s", f, err.Error())
+			continue
+		}
+
+		if old, ok := w.hashes[f]; !ok || old != sum {
+			if ok {
+				changed = append(changed, f)
+			}
+			w.hashes[f] = sum
+		}
+	}
+
+	return changed
+}
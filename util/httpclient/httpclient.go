@@ -0,0 +1,55 @@
+// HTTP client for outbound calls, it forwards the request ID and
+// trace headers of the incoming request.
+//
+// Pass the request context, ex: http.NewRequestWithContext(c.UserContext(), ...)
+package httpclient
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/baozhenglab/go-sdk/v2/util/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Transport adds the request ID and trace headers from the request context.
+// The request ID is sent in the header it was received in (see
+// -fiber-request-id-header), unless Header is set
+type Transport struct {
+	// Base is used to make requests, default is http.DefaultTransport
+	Base http.RoundTripper
+	// Header of the request ID of outbound calls, ex: an API expecting X-Correlation-ID
+	Header string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx := req.Context()
+	id := requestid.FromContext(ctx)
+	header := t.Header
+	if header == "" {
+		header = requestid.HeaderFromContext(ctx)
+	}
+
+	// RoundTrip must not modify the request, so clone it
+	req = req.Clone(ctx)
+	if id != "" && req.Header.Get(header) == "" {
+		req.Header.Set(header, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return base.RoundTrip(req)
+}
+
+// New returns a client with the forwarding Transport
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &Transport{},
+		Timeout:   timeout,
+	}
+}
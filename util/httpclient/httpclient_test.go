@@ -0,0 +1,61 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baozhenglab/go-sdk/v2/util/requestid"
+)
+
+func TestTransport(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		transport  *Transport
+		header     http.Header
+		wantHeader string
+		wantID     string
+	}{
+		{"no request id", context.Background(), &Transport{}, nil, requestid.Header, ""},
+		{"default header", requestid.NewContext(context.Background(), "abc"), &Transport{}, nil, requestid.Header, "abc"},
+		{"header of the server", requestid.NewContextWithHeader(context.Background(), "abc", "X-Correlation-ID"),
+			&Transport{}, nil, "X-Correlation-ID", "abc"},
+		{"header of the transport", requestid.NewContextWithHeader(context.Background(), "abc", "X-Correlation-ID"),
+			&Transport{Header: "X-Trace-Ref"}, nil, "X-Trace-Ref", "abc"},
+		{"set by the caller", requestid.NewContext(context.Background(), "abc"), &Transport{},
+			http.Header{requestid.Header: {"mine"}}, requestid.Header, "mine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(tt.ctx, http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			resp, err := (&http.Client{Transport: tt.transport}).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if id := got.Get(tt.wantHeader); id != tt.wantID {
+				t.Errorf("%s = %q, want %q", tt.wantHeader, id, tt.wantID)
+			}
+			// the request of the caller is not modified
+			if tt.header == nil && len(req.Header) != 0 {
+				t.Errorf("request headers modified: %v", req.Header)
+			}
+		})
+	}
+}
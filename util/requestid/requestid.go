@@ -0,0 +1,75 @@
+// Request ID (correlation ID) carried by contexts and http headers
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+	Header    = "X-Request-ID"
+	maxLength = 128
+)
+
+type ctxKey struct{}
+
+// value of ctxKey, header is where the ID is read from and forwarded to
+type ctxValue struct {
+	id     string
+	header string
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return NewContextWithHeader(ctx, id, Header)
+}
+
+// NewContextWithHeader returns a copy of ctx carrying the request ID
+// and its header, ex: a server configured with another header than X-Request-ID
+func NewContextWithHeader(ctx context.Context, id, header string) context.Context {
+	if header == "" {
+		header = Header
+	}
+	return context.WithValue(ctx, ctxKey{}, ctxValue{id, header})
+}
+
+// FromContext returns the request ID of ctx, empty if there is none
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	v, _ := ctx.Value(ctxKey{}).(ctxValue)
+	return v.id
+}
+
+// HeaderFromContext returns the header of the request ID of ctx, default is Header
+func HeaderFromContext(ctx context.Context) string {
+	if ctx != nil {
+		if v, ok := ctx.Value(ctxKey{}).(ctxValue); ok {
+			return v.header
+		}
+	}
+	return Header
+}
+
+// New generates a random request ID
+func New() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IsValid checks a request ID from clients, so logs and headers
+// can't be polluted by them
+func IsValid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}